@@ -0,0 +1,359 @@
+// Package breaker protects calls to degraded dependencies with circuit breaker. Failures
+// are classified the same way waitfor classifies probe's errors, so one dependency
+// description (name, probe, classifier, registry) drives both startup wait and runtime
+// protection.
+package breaker
+
+import (
+	"context"
+	std_errors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hummerd/gostuff/waitfor"
+)
+
+// Breaker states.
+const (
+	// Closed breaker lets calls through and counts failures.
+	Closed State = iota
+	// Open breaker rejects calls with *OpenError.
+	Open
+	// HalfOpen breaker lets limited number of trial calls through. Breaker closes
+	// if they succeed and opens again if any of them fails.
+	HalfOpen
+)
+
+// Default settings.
+const (
+	DefaultWindow      = 10 * time.Second
+	DefaultBuckets     = 10
+	DefaultMinRequests = 10
+	DefaultFailureRate = 0.5
+	DefaultOpenTimeout = 5 * time.Second
+)
+
+// State is breaker's state.
+type State int
+
+// String returns state name.
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// OpenError is returned for calls rejected by open breaker.
+type OpenError struct {
+	Name string
+	// Until is time when breaker lets trial calls through.
+	Until time.Time
+	// Err is failure that opened breaker.
+	Err error
+}
+
+// Error returns error's text
+func (e *OpenError) Error() string {
+	msg := fmt.Sprintf("Circuit breaker %s is open until %s", e.Name, e.Until.Format(time.RFC3339))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Cause returns failure that opened breaker.
+func (e *OpenError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the same error as Cause.
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+// Breaker is circuit breaker with sliding window failure rate. Zero Breaker uses default
+// settings. Breaker must not be copied after first use.
+type Breaker struct {
+	// Name is dependency's name, used in errors, callbacks and registry.
+	Name string
+	// Window is length of sliding window failure rate is calculated over. If zero,
+	// DefaultWindow is used.
+	Window time.Duration
+	// Buckets is number of parts window is divided into, window slides by one bucket.
+	// If zero, DefaultBuckets is used.
+	Buckets int
+	// MinRequests is minimum number of calls in window required to open breaker. If zero,
+	// DefaultMinRequests is used.
+	MinRequests int
+	// FailureRate is fraction of failed calls in window that opens breaker. If zero,
+	// DefaultFailureRate is used.
+	FailureRate float64
+	// OpenTimeout is time breaker stays open before it lets trial calls through. If zero,
+	// DefaultOpenTimeout is used.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is number of successful trial calls required to close breaker.
+	// If zero, one trial call is used.
+	HalfOpenRequests int
+	// Probe if not nil is checked before trial calls, dependency's trial call is made only
+	// if probe succeeds. The same probe can be used by waitfor on startup.
+	Probe waitfor.Probe
+	// Classify tells failures from other errors: only retryable errors are failures,
+	// permanent errors (rejected credentials, invalid address and so on) do not open
+	// breaker. If nil, waitfor.ClassifyError is used.
+	Classify waitfor.Classifier
+	// Registry if not nil records result of every call, so dependency's state is reported
+	// by waitfor's snapshot and metrics.
+	Registry *waitfor.Registry
+	// OnStateChange if not nil is called on every state change.
+	OnStateChange func(name string, from, to State)
+
+	mu       sync.Mutex
+	state    State
+	window   *window
+	openedAt time.Time
+	lastErr  error
+	trials   int
+	passed   int
+}
+
+// State returns current state.
+func (b *Breaker) State() State {
+	var from, to State
+	defer func() { b.notify(from, to) }()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from, to = b.refresh(time.Now())
+	return b.state
+}
+
+// Do calls fn if breaker allows it and records result. Returns *OpenError without
+// calling fn if breaker is open.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := Call(ctx, b, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Call is Do for functions with result.
+func Call[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+
+	trial, err := b.allow()
+	if err != nil {
+		return zero, err
+	}
+
+	if trial && b.Probe != nil {
+		start := time.Now()
+		err = b.Probe.Probe(ctx)
+		if err != nil {
+			b.done(trial, err, true, time.Since(start))
+			return zero, b.openError()
+		}
+	}
+
+	start := time.Now()
+	res, err := fn(ctx)
+	if err != nil && ctx.Err() == context.Canceled && std_errors.Is(err, context.Canceled) {
+		// canceled by caller, says nothing about dependency
+		b.cancel(trial)
+		return res, err
+	}
+	b.done(trial, err, b.failed(err), time.Since(start))
+	return res, err
+}
+
+// Allow checks whether call can be made. If it can, returned done must be called once with
+// call's result, call's latency is time between Allow and done. Use Do or Call if possible.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	trial, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.done(trial, err, b.failed(err), time.Since(start)) })
+	}, nil
+}
+
+// allow checks whether call can be made, trial is true for calls made in half-open state.
+func (b *Breaker) allow() (trial bool, err error) {
+	var from, to State
+	defer func() { b.notify(from, to) }()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from, to = b.refresh(time.Now())
+	switch b.state {
+	case Open:
+		return false, b.openErrorLocked()
+	case HalfOpen:
+		if b.trials >= b.halfOpenRequests() {
+			return false, b.openErrorLocked()
+		}
+		b.trials++
+		return true, nil
+	}
+	return false, nil
+}
+
+// cancel releases trial call which result is unknown.
+func (b *Breaker) cancel(trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial && b.state == HalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+// done records call's result.
+func (b *Breaker) done(trial bool, err error, failed bool, latency time.Duration) {
+	if b.Registry != nil {
+		b.Registry.Record(b.Name, err, latency)
+	}
+
+	var from, to State
+	defer func() { b.notify(from, to) }()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	from, to = b.refresh(now)
+	if failed {
+		b.lastErr = err
+	}
+
+	switch {
+	case trial && b.state == HalfOpen:
+		if failed {
+			to = b.setState(Open, now)
+			return
+		}
+		b.passed++
+		if b.passed >= b.halfOpenRequests() {
+			to = b.setState(Closed, now)
+		}
+	case b.state == Closed:
+		if err != nil && !failed {
+			// permanent error (invalid request, rejected credentials) tells nothing about
+			// dependency's availability, so it is counted neither as success nor as failure
+			return
+		}
+		w := b.getWindow()
+		w.add(now, failed)
+		total, failures := w.counts(now)
+		if failed && total >= b.minRequests() && float64(failures) >= b.failureRate()*float64(total) {
+			to = b.setState(Open, now)
+		}
+	}
+}
+
+// failed reports whether call's error is dependency's failure.
+func (b *Breaker) failed(err error) bool {
+	return err != nil && b.classify(err) == waitfor.Retryable
+}
+
+// refresh moves open breaker to half-open after timeout. Returns state change, if any.
+func (b *Breaker) refresh(now time.Time) (from, to State) {
+	from = b.state
+	if b.state == Open && now.Sub(b.openedAt) >= b.openTimeout() {
+		return from, b.setState(HalfOpen, now)
+	}
+	return from, from
+}
+
+// setState changes state and returns it.
+func (b *Breaker) setState(s State, now time.Time) State {
+	b.state = s
+	b.trials = 0
+	b.passed = 0
+
+	switch s {
+	case Open:
+		b.openedAt = now
+	case Closed:
+		b.getWindow().reset()
+		b.lastErr = nil
+	}
+	return s
+}
+
+// notify calls OnStateChange, it must be called with b.mu unlocked.
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(b.Name, from, to)
+	}
+}
+
+func (b *Breaker) openError() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openErrorLocked()
+}
+
+func (b *Breaker) openErrorLocked() error {
+	return &OpenError{Name: b.Name, Until: b.openedAt.Add(b.openTimeout()), Err: b.lastErr}
+}
+
+func (b *Breaker) getWindow() *window {
+	if b.window == nil {
+		window := b.Window
+		if window <= 0 {
+			window = DefaultWindow
+		}
+		buckets := b.Buckets
+		if buckets <= 0 {
+			buckets = DefaultBuckets
+		}
+		b.window = newWindow(window, buckets)
+	}
+	return b.window
+}
+
+func (b *Breaker) classify(err error) waitfor.ErrorClass {
+	if b.Classify != nil {
+		return b.Classify(err)
+	}
+	return waitfor.ClassifyError(err)
+}
+
+func (b *Breaker) minRequests() int {
+	if b.MinRequests > 0 {
+		return b.MinRequests
+	}
+	return DefaultMinRequests
+}
+
+func (b *Breaker) failureRate() float64 {
+	if b.FailureRate > 0 {
+		return b.FailureRate
+	}
+	return DefaultFailureRate
+}
+
+func (b *Breaker) openTimeout() time.Duration {
+	if b.OpenTimeout > 0 {
+		return b.OpenTimeout
+	}
+	return DefaultOpenTimeout
+}
+
+func (b *Breaker) halfOpenRequests() int {
+	if b.HalfOpenRequests > 0 {
+		return b.HalfOpenRequests
+	}
+	return 1
+}
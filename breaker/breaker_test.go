@@ -0,0 +1,234 @@
+package breaker
+
+import (
+	"context"
+	std_errors "errors"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+	"github.com/hummerd/gostuff/waitfor"
+)
+
+func fail(ctx context.Context) error {
+	return syscall.ECONNREFUSED
+}
+
+func succeed(ctx context.Context) error {
+	return nil
+}
+
+func TestBreaker(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+
+	b := &Breaker{
+		Name:        "db",
+		MinRequests: 4,
+		FailureRate: 0.5,
+		OpenTimeout: time.Millisecond * 100,
+		OnStateChange: func(name string, from, to State) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, name+": "+from.String()+" -> "+to.String())
+		},
+	}
+	ctx := context.Background()
+
+	// not enough requests
+	_ = b.Do(ctx, succeed)
+	_ = b.Do(ctx, fail)
+	_ = b.Do(ctx, succeed)
+	if b.State() != Closed {
+		t.Fatal("Breaker opened too early")
+	}
+
+	err := b.Do(ctx, fail)
+	if err != syscall.ECONNREFUSED || b.State() != Open {
+		t.Fatal("Breaker not opened", err, b.State())
+	}
+
+	called := false
+	err = b.Do(ctx, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	var oe *OpenError
+	if called || !std_errors.As(err, &oe) || oe.Name != "db" || !std_errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatal("Open breaker let call through", err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	if b.State() != HalfOpen {
+		t.Fatal("Breaker not half-open", b.State())
+	}
+
+	// failed trial opens breaker again
+	_ = b.Do(ctx, fail)
+	if b.State() != Open {
+		t.Fatal("Breaker not reopened", b.State())
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	err = b.Do(ctx, succeed)
+	if err != nil || b.State() != Closed {
+		t.Fatal("Breaker not closed", err, b.State())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := "db: closed -> open, db: open -> half-open, db: half-open -> open, " +
+		"db: open -> half-open, db: half-open -> closed"
+	if strings.Join(changes, ", ") != expected {
+		t.Fatal("Wrong state changes", changes)
+	}
+}
+
+func TestBreakerClassify(t *testing.T) {
+	b := &Breaker{Name: "api"}
+	ctx := context.Background()
+
+	// zero breaker needs DefaultMinRequests calls to open
+	for i := 0; i < DefaultMinRequests-1; i++ {
+		_ = b.Do(ctx, fail)
+	}
+	if b.State() != Closed {
+		t.Fatal("Breaker opened before DefaultMinRequests calls")
+	}
+	_ = b.Do(ctx, fail)
+	if b.State() != Open {
+		t.Fatal("Breaker not opened after DefaultMinRequests calls")
+	}
+	b = &Breaker{Name: "api"}
+
+	// permanent errors do not open breaker
+	for i := 0; i < 10; i++ {
+		_ = b.Do(ctx, func(ctx context.Context) error { return syscall.EACCES })
+	}
+	if b.State() != Closed {
+		t.Fatal("Permanent errors opened breaker")
+	}
+
+	// permanent errors are not counted as successes either
+	b = &Breaker{Name: "api", MinRequests: 2, FailureRate: 0.5}
+	for i := 0; i < 3; i++ {
+		_ = b.Do(ctx, func(ctx context.Context) error { return syscall.EACCES })
+	}
+	_ = b.Do(ctx, fail)
+	_ = b.Do(ctx, fail)
+	if b.State() != Open {
+		t.Fatal("Permanent errors counted as successes", b.State())
+	}
+	b = &Breaker{Name: "api"}
+
+	// canceled calls are not counted
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	for i := 0; i < 10; i++ {
+		_ = b.Do(cctx, func(ctx context.Context) error { return ctx.Err() })
+	}
+	if b.State() != Closed {
+		t.Fatal("Canceled calls opened breaker")
+	}
+
+	n, err := Call(ctx, b, func(ctx context.Context) (int, error) { return 42, nil })
+	if n != 42 || err != nil {
+		t.Fatal("Wrong result", n, err)
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	up := false
+	r := waitfor.NewRegistry()
+	b := &Breaker{
+		Name:        "cache",
+		MinRequests: 1,
+		OpenTimeout: time.Millisecond * 50,
+		Registry:    r,
+		Probe: waitfor.ProbeFunc(func(ctx context.Context) error {
+			if !up {
+				return errors.New("cache is down")
+			}
+			return nil
+		}),
+	}
+	ctx := context.Background()
+
+	_ = b.Do(ctx, fail)
+	if b.State() != Open {
+		t.Fatal("Breaker not opened")
+	}
+	s := r.Snapshot()
+	if len(s.Endpoints) != 1 || s.Endpoints[0].State != waitfor.StateDown {
+		t.Fatal("Failure not recorded", s)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	called := false
+	err := b.Do(ctx, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if called || err == nil || b.State() != Open {
+		t.Fatal("Call made while probe fails", err)
+	}
+
+	up = true
+	time.Sleep(time.Millisecond * 50)
+	err = b.Do(ctx, succeed)
+	if err != nil || b.State() != Closed {
+		t.Fatal("Breaker not closed", err)
+	}
+	if r.Snapshot().Endpoints[0].State != waitfor.StateUp {
+		t.Fatal("Success not recorded")
+	}
+}
+
+func TestBreakerAllow(t *testing.T) {
+	r := waitfor.NewRegistry()
+	b := &Breaker{Name: "db", Registry: r}
+
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	done(nil)
+	done(errors.New("ignored"))
+
+	s := r.Snapshot()
+	if len(s.Endpoints) != 1 || s.Endpoints[0].State != waitfor.StateUp ||
+		s.Endpoints[0].Latency < time.Millisecond*20 {
+		t.Fatal("Wrong call recorded", s)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := newWindow(time.Second, 10)
+	now := time.Unix(1000, 0)
+
+	w.add(now, true)
+	w.add(now.Add(time.Millisecond*150), false)
+	w.add(now.Add(time.Millisecond*950), true)
+
+	total, failures := w.counts(now.Add(time.Millisecond * 950))
+	if total != 3 || failures != 2 {
+		t.Fatal("Wrong counts", total, failures)
+	}
+
+	// first bucket left the window
+	total, failures = w.counts(now.Add(time.Millisecond * 1050))
+	if total != 2 || failures != 1 {
+		t.Fatal("Wrong counts", total, failures)
+	}
+
+	// bucket is reused
+	w.add(now.Add(time.Millisecond*2150), true)
+	total, failures = w.counts(now.Add(time.Millisecond * 2150))
+	if total != 1 || failures != 1 {
+		t.Fatal("Wrong counts", total, failures)
+	}
+}
@@ -0,0 +1,55 @@
+package breaker
+
+import "time"
+
+// window counts calls and failures in sliding time window divided into buckets.
+type window struct {
+	width   time.Duration // bucket's width
+	buckets []bucket
+}
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+func newWindow(length time.Duration, buckets int) *window {
+	width := length / time.Duration(buckets)
+	if width <= 0 {
+		width = 1
+	}
+	return &window{width: width, buckets: make([]bucket, buckets)}
+}
+
+// add adds call to bucket for now, reusing buckets that left the window.
+func (w *window) add(now time.Time, failed bool) {
+	start := now.Truncate(w.width)
+	b := &w.buckets[int(start.UnixNano()/int64(w.width))%len(w.buckets)]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+
+	b.total++
+	if failed {
+		b.failures++
+	}
+}
+
+// counts returns number of calls and failures in window ending at now.
+func (w *window) counts(now time.Time) (total, failures int) {
+	from := now.Truncate(w.width).Add(-w.width * time.Duration(len(w.buckets)-1))
+	for _, b := range w.buckets {
+		if !b.start.Before(from) && !b.start.After(now) {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return total, failures
+}
+
+func (w *window) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
@@ -30,6 +30,11 @@ func (we *wrappedError) Cause() error {
 	return we.cause
 }
 
+// Unwrap returns error's cause, so wrapped errors can be checked with standard errors.Is and errors.As
+func (we *wrappedError) Unwrap() error {
+	return we.cause
+}
+
 // Cause returns the underlying cause of the error, if possible.
 // An error value has a cause if it implements the following
 // interface:
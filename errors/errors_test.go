@@ -1,6 +1,8 @@
 package errors
 
 import (
+	std_errors "errors"
+	"io"
 	"testing"
 )
 
@@ -34,6 +36,11 @@ func TestError(t *testing.T) {
 	if e.Error() != "test msg err1" {
 		t.Fatal("Wrong wrap")
 	}
+
+	e = Wrap(Wrap(io.EOF, "inner "), "outer ")
+	if !std_errors.Is(e, io.EOF) || Cause(e) != io.EOF {
+		t.Fatal("Wrong unwrap")
+	}
 }
 
 func TestJointError(t *testing.T) {
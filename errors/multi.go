@@ -66,3 +66,15 @@ func (e *MultiError) IfHasErrors() error {
 	}
 	return nil
 }
+
+// Unwrap returns actual (non nil) errors, so MultiError can be checked with standard
+// errors.Is and errors.As.
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, 0, e.actual)
+	for _, err := range e.errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
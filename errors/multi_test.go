@@ -1,6 +1,8 @@
 package errors
 
 import (
+	std_errors "errors"
+	"io"
 	"testing"
 )
 
@@ -43,3 +45,15 @@ func TestNewMuiltiError(t *testing.T) {
 		t.Fatal("Wrong err message")
 	}
 }
+
+func TestMultiErrorUnwrap(t *testing.T) {
+	me := NewMultiError(New("err1"), nil, Wrap(io.EOF, "read failed: "))
+
+	if len(me.Unwrap()) != 2 {
+		t.Fatal("Wrong unwrapped errors")
+	}
+
+	if !std_errors.Is(me, io.EOF) {
+		t.Fatal("Wrapped error not found")
+	}
+}
@@ -0,0 +1,319 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+	"github.com/hummerd/gostuff/waitfor"
+)
+
+// Timeline phases.
+const (
+	// PhaseWait is wait for external dependency.
+	PhaseWait Phase = iota
+	// PhaseStart is component's start.
+	PhaseStart
+	// PhaseRollback is stop of started component after failed startup.
+	PhaseRollback
+)
+
+// Phase is startup's phase.
+type Phase int
+
+// String returns phase name.
+func (p Phase) String() string {
+	switch p {
+	case PhaseStart:
+		return "start"
+	case PhaseRollback:
+		return "rollback"
+	}
+	return "wait"
+}
+
+// MarshalText returns phase name.
+func (p Phase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Component is part of application with start and stop hooks.
+type Component struct {
+	// Name is component's name, other components refer to it in DependsOn.
+	Name string
+	// DependsOn are names of components that must be started before this one.
+	DependsOn []string
+	// Start starts component. Long running components should start in background
+	// and return when they are ready.
+	Start func(ctx context.Context) error
+	// Stop stops component on shutdown or rollback. Can be nil.
+	Stop func(ctx context.Context) error
+	// StopTimeout limits Stop. Zero means Stop is limited only by shutdown's timeout.
+	StopTimeout time.Duration
+}
+
+// StartError is failure of component's start.
+type StartError struct {
+	Name string
+	Err  error
+	// Rollback is *errors.MultiError with *CloseError of every component that failed
+	// to stop during rollback, or nil.
+	Rollback error
+}
+
+// Error returns error's text
+func (e *StartError) Error() string {
+	msg := "Failed to start " + e.Name + ": " + e.Err.Error()
+	if e.Rollback != nil {
+		msg += "; rollback failed: " + e.Rollback.Error()
+	}
+	return msg
+}
+
+// Cause returns start's error.
+func (e *StartError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the same error as Cause.
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// Event is single step of startup.
+type Event struct {
+	Phase Phase `json:"phase"`
+	// Name is dependency's or component's name.
+	Name    string        `json:"name"`
+	Start   time.Time     `json:"start"`
+	Elapsed time.Duration `json:"elapsed"`
+	// Error is text of step's error, empty if step succeeded.
+	Error string `json:"error,omitempty"`
+	// Optional is true for optional dependencies, which failure does not fail startup.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Timeline is report of whole startup.
+type Timeline struct {
+	Start   time.Time     `json:"start"`
+	Elapsed time.Duration `json:"elapsed"`
+	Events  []Event       `json:"events"`
+}
+
+// String returns human readable report.
+func (t *Timeline) String() string {
+	b := &strings.Builder{}
+	_, _ = t.WriteTo(b)
+	return b.String()
+}
+
+// WriteTo writes human readable report to w, event's offsets are relative to startup's start.
+func (t *Timeline) WriteTo(w io.Writer) (int64, error) {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Startup at %s took %s\n", t.Start.Format(time.RFC3339), t.Elapsed.Round(time.Microsecond))
+	for _, e := range t.Events {
+		fmt.Fprintf(b, "+%-10s %-8s %s (%s)", e.Start.Sub(t.Start).Round(time.Microsecond),
+			e.Phase, e.Name, e.Elapsed.Round(time.Microsecond))
+		if e.Optional {
+			b.WriteString(" optional")
+		}
+		if e.Error != "" {
+			fmt.Fprintf(b, ": %s", e.Error)
+		}
+		b.WriteString("\n")
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (t *Timeline) add(phase Phase, name string, start time.Time, err error) {
+	e := Event{Phase: phase, Name: name, Start: start, Elapsed: time.Since(start)}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	t.Events = append(t.Events, e)
+}
+
+// App starts application: waits for external dependencies, then starts components in
+// dependency order. Started components are registered in Shutdown. App must not be copied
+// after first use.
+type App struct {
+	// Waiter waits for Dependencies. If nil, zero Waiter is used.
+	Waiter *waitfor.Waiter
+	// Dependencies are external services waited before components are started.
+	Dependencies []waitfor.Service
+	// Components are started in dependency order, components without dependencies
+	// between them are started in the order they were added.
+	Components []Component
+	// Shutdown stops started components in reverse start order.
+	Shutdown Shutdown
+}
+
+// Add adds component.
+func (a *App) Add(c Component) {
+	a.Components = append(a.Components, c)
+}
+
+// Start waits for dependencies and starts components. If component fails to start,
+// components started before it are stopped in reverse order and *StartError is returned.
+// Rollback is limited by Shutdown.Timeout. Timeline is returned in all cases.
+func (a *App) Start(ctx context.Context) (*Timeline, error) {
+	t := &Timeline{Start: time.Now()}
+	defer func() { t.Elapsed = time.Since(t.Start) }()
+
+	order, err := a.order()
+	if err != nil {
+		return t, err
+	}
+
+	err = a.wait(ctx, t)
+	if err != nil {
+		return t, err
+	}
+
+	started := make([]Component, 0, len(order))
+	for _, c := range order {
+		start := time.Now()
+		if c.Start != nil {
+			err = c.Start(ctx)
+		}
+		t.add(PhaseStart, c.Name, start, err)
+		if err != nil {
+			// rollback is not canceled with startup, but limited like shutdown
+			rctx, cancel := a.Shutdown.limit(context.WithoutCancel(ctx))
+			rb := rollback(rctx, t, started)
+			cancel()
+			return t, &StartError{Name: c.Name, Err: err, Rollback: rb}
+		}
+		started = append(started, c)
+	}
+
+	for _, c := range started {
+		a.Shutdown.Register(closer(c))
+	}
+	return t, nil
+}
+
+// Run starts application and blocks until one of signals is received or ctx is done, then
+// shuts application down. Signals are handled during startup too: they cancel startup and
+// started components are rolled back. See Shutdown.Wait for signals used by default.
+func (a *App) Run(ctx context.Context, signals ...os.Signal) (*Timeline, error) {
+	sctx, stop := notifyContext(ctx, signals)
+	defer stop()
+
+	t, err := a.Start(sctx)
+	if err != nil {
+		return t, err
+	}
+
+	<-sctx.Done()
+	stop()
+	return t, a.Shutdown.Close(context.WithoutCancel(ctx))
+}
+
+// wait waits for dependencies and adds them to timeline.
+func (a *App) wait(ctx context.Context, t *Timeline) error {
+	if len(a.Dependencies) == 0 {
+		return nil
+	}
+
+	w := a.Waiter
+	if w == nil {
+		w = &waitfor.Waiter{}
+	}
+
+	start := time.Now()
+	report, err := w.Wait(ctx, a.Dependencies...)
+	if report != nil {
+		for _, s := range report.Services {
+			e := Event{Phase: PhaseWait, Name: s.Name, Start: start, Elapsed: s.Elapsed, Optional: s.Optional}
+			if s.Err != nil {
+				e.Error = s.Err.Error()
+			}
+			t.Events = append(t.Events, e)
+			start = start.Add(s.Elapsed)
+		}
+	}
+	return err
+}
+
+// order returns components sorted by dependencies. Fails on unknown dependency, duplicate
+// name or dependency cycle.
+func (a *App) order() ([]Component, error) {
+	index := make(map[string]int, len(a.Components))
+	for i, c := range a.Components {
+		if _, ok := index[c.Name]; ok {
+			return nil, errors.New("Duplicate component " + c.Name)
+		}
+		index[c.Name] = i
+	}
+	for _, c := range a.Components {
+		for _, d := range c.DependsOn {
+			if _, ok := index[d]; !ok {
+				return nil, errors.Newf("Component %s depends on unknown component %s", c.Name, d)
+			}
+		}
+	}
+
+	order := make([]Component, 0, len(a.Components))
+	done := make([]bool, len(a.Components))
+	for len(order) < len(a.Components) {
+		progress := false
+		for i, c := range a.Components {
+			if done[i] || !ready(c, index, done) {
+				continue
+			}
+			done[i] = true
+			order = append(order, c)
+			progress = true
+			break // keep added order among ready components
+		}
+		if !progress {
+			var cycle []string
+			for i, c := range a.Components {
+				if !done[i] {
+					cycle = append(cycle, c.Name)
+				}
+			}
+			return nil, errors.New("Dependency cycle between components " + strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+func ready(c Component, index map[string]int, done []bool) bool {
+	for _, d := range c.DependsOn {
+		if !done[index[d]] {
+			return false
+		}
+	}
+	return true
+}
+
+// rollback stops started components in reverse order.
+func rollback(ctx context.Context, t *Timeline, started []Component) error {
+	me := errors.NewMultiError()
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		if c.Stop == nil {
+			continue
+		}
+
+		start := time.Now()
+		err := closeOne(ctx, closer(c))
+		t.add(PhaseRollback, c.Name, start, err)
+		if err != nil {
+			me.Add(&CloseError{Name: c.Name, Err: err})
+		}
+	}
+	return me.IfHasErrors()
+}
+
+func closer(c Component) Closer {
+	return Closer{Name: c.Name, Timeout: c.StopTimeout, Close: c.Stop}
+}
@@ -0,0 +1,172 @@
+package lifecycle
+
+import (
+	"context"
+	std_errors "errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+	"github.com/hummerd/gostuff/waitfor"
+)
+
+// recorder records start and stop calls of components.
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) component(name string, startErr, stopErr error, deps ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: deps,
+		Start: func(ctx context.Context) error {
+			r.calls = append(r.calls, "start "+name)
+			return startErr
+		},
+		Stop: func(ctx context.Context) error {
+			r.calls = append(r.calls, "stop "+name)
+			return stopErr
+		},
+	}
+}
+
+func TestAppStart(t *testing.T) {
+	r := &recorder{}
+	a := &App{
+		Waiter: &waitfor.Waiter{Timeout: time.Second, Registry: waitfor.NewRegistry()},
+		Dependencies: []waitfor.Service{
+			{Name: "db", Probe: waitfor.ProbeFunc(func(ctx context.Context) error { return nil })},
+		},
+	}
+	a.Add(r.component("http", nil, nil, "cache", "db"))
+	a.Add(r.component("db", nil, nil))
+	a.Add(r.component("cache", nil, nil, "db"))
+	a.Add(r.component("metrics", nil, nil))
+
+	tl, err := a.Start(context.Background())
+	if err != nil {
+		t.Fatal("Start failed", err)
+	}
+	if strings.Join(r.calls, ",") != "start db,start cache,start http,start metrics" {
+		t.Fatal("Wrong start order", r.calls)
+	}
+
+	if len(tl.Events) != 5 || tl.Events[0].Phase != PhaseWait || tl.Events[0].Name != "db" ||
+		tl.Events[3].Phase != PhaseStart || tl.Events[3].Name != "http" {
+		t.Fatal("Wrong timeline", tl)
+	}
+	if !strings.Contains(tl.String(), "start    cache") {
+		t.Fatal("Wrong timeline text", tl)
+	}
+
+	r.calls = nil
+	err = a.Shutdown.Close(context.Background())
+	if err != nil || strings.Join(r.calls, ",") != "stop metrics,stop http,stop cache,stop db" {
+		t.Fatal("Wrong stop order", r.calls, err)
+	}
+}
+
+func TestAppRollback(t *testing.T) {
+	r := &recorder{}
+	a := &App{}
+	a.Add(r.component("db", nil, nil))
+	a.Add(r.component("cache", nil, io.ErrClosedPipe, "db"))
+	a.Add(r.component("http", io.EOF, nil, "cache"))
+	a.Add(r.component("metrics", nil, nil, "http"))
+
+	tl, err := a.Start(context.Background())
+	var se *StartError
+	if !std_errors.As(err, &se) || se.Name != "http" || se.Err != io.EOF {
+		t.Fatal("Expected http start error", err)
+	}
+	var ce *CloseError
+	if !std_errors.As(se.Rollback, &ce) || ce.Name != "cache" || ce.Err != io.ErrClosedPipe {
+		t.Fatal("Expected cache rollback error", se.Rollback)
+	}
+	if strings.Join(r.calls, ",") != "start db,start cache,start http,stop cache,stop db" {
+		t.Fatal("Wrong rollback", r.calls)
+	}
+
+	last := tl.Events[len(tl.Events)-1]
+	if len(tl.Events) != 5 || last.Phase != PhaseRollback || last.Name != "db" ||
+		tl.Events[1].Error != "" || tl.Events[3].Error == "" {
+		t.Fatal("Wrong timeline", tl)
+	}
+
+	// nothing is left for shutdown
+	r.calls = nil
+	_ = a.Shutdown.Close(context.Background())
+	if len(r.calls) != 0 {
+		t.Fatal("Rolled back components stopped again", r.calls)
+	}
+}
+
+func TestAppRollbackTimeout(t *testing.T) {
+	r := &recorder{}
+	a := &App{Shutdown: Shutdown{Timeout: time.Millisecond * 100}}
+	a.Add(Component{
+		Name:  "db",
+		Start: func(ctx context.Context) error { return nil },
+		Stop:  func(ctx context.Context) error { select {} }, // hangs, no StopTimeout
+	})
+	a.Add(r.component("http", io.EOF, nil, "db"))
+
+	start := time.Now()
+	_, err := a.Start(context.Background())
+	var se *StartError
+	if !std_errors.As(err, &se) || se.Rollback == nil || time.Since(start) > time.Second {
+		t.Fatal("Rollback not limited by shutdown timeout", err, time.Since(start))
+	}
+}
+
+func TestAppWaitFail(t *testing.T) {
+	r := &recorder{}
+	a := &App{
+		Waiter: &waitfor.Waiter{Timeout: time.Millisecond * 100, RetryAfter: time.Millisecond * 10, Registry: waitfor.NewRegistry()},
+		Dependencies: []waitfor.Service{
+			{Name: "cache", Optional: true, Timeout: time.Millisecond * 20,
+				Probe: waitfor.ProbeFunc(func(ctx context.Context) error { return errors.New("down") })},
+			{Name: "db", Probe: waitfor.ProbeFunc(func(ctx context.Context) error { return errors.New("down") })},
+		},
+	}
+	a.Add(r.component("http", nil, nil))
+
+	tl, err := a.Start(context.Background())
+	if err == nil || len(r.calls) != 0 {
+		t.Fatal("Components started without dependencies", err, r.calls)
+	}
+	if len(tl.Events) != 2 || !tl.Events[0].Optional || tl.Events[1].Error == "" ||
+		!tl.Events[1].Start.After(tl.Events[0].Start) {
+		t.Fatal("Wrong timeline", tl)
+	}
+}
+
+func TestAppOrderErrors(t *testing.T) {
+	r := &recorder{}
+	a := &App{}
+	a.Add(r.component("http", nil, nil, "cache"))
+	a.Add(r.component("cache", nil, nil, "http"))
+	a.Add(r.component("db", nil, nil))
+
+	_, err := a.Start(context.Background())
+	if err == nil || err.Error() != "Dependency cycle between components http, cache" || len(r.calls) != 0 {
+		t.Fatal("Expected cycle error", err, r.calls)
+	}
+
+	a = &App{}
+	a.Add(r.component("http", nil, nil, "db"))
+	_, err = a.Start(context.Background())
+	if err == nil || err.Error() != "Component http depends on unknown component db" {
+		t.Fatal("Expected unknown dependency error", err)
+	}
+
+	a = &App{}
+	a.Add(r.component("http", nil, nil))
+	a.Add(r.component("http", nil, nil))
+	_, err = a.Start(context.Background())
+	if err == nil || err.Error() != "Duplicate component http" {
+		t.Fatal("Expected duplicate error", err)
+	}
+}
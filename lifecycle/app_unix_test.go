@@ -0,0 +1,62 @@
+//go:build unix
+
+package lifecycle
+
+import (
+	"context"
+	std_errors "errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAppRunSignalDuringStart(t *testing.T) {
+	// keep signal from killing test process if it comes before Run subscribes
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, syscall.SIGUSR2)
+	defer signal.Stop(ignored)
+
+	r := &recorder{}
+	a := &App{}
+	a.Add(r.component("db", nil, nil))
+	a.Add(Component{
+		Name:      "http",
+		DependsOn: []string{"db"},
+		Start: func(ctx context.Context) error {
+			<-ctx.Done() // long startup
+			return ctx.Err()
+		},
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := a.Run(context.Background(), syscall.SIGUSR2)
+		done <- err
+	}()
+
+	timeout := time.After(time.Second)
+	for {
+		err := syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+		if err != nil {
+			t.Fatal("Can not send signal", err)
+		}
+
+		select {
+		case err = <-done:
+			var se *StartError
+			if !std_errors.As(err, &se) || se.Name != "http" || !std_errors.Is(err, context.Canceled) {
+				t.Fatal("Startup not canceled", err)
+			}
+			if strings.Join(r.calls, ",") != "start db,stop db" {
+				t.Fatal("Started components not rolled back", r.calls)
+			}
+			return
+		case <-timeout:
+			t.Fatal("Signal not handled")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
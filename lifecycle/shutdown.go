@@ -0,0 +1,170 @@
+// Package lifecycle orchestrates application's startup and graceful shutdown.
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// Closer is component's shutdown hook.
+type Closer struct {
+	// Name is component's name, used in errors.
+	Name string
+	// Priority orders closers: closers with higher priority are closed first. Closers with
+	// the same priority are closed in reverse registration (start) order.
+	Priority int
+	// Timeout limits closer. Zero means closer is limited only by shutdown's timeout.
+	Timeout time.Duration
+	// Close releases component. Close should return when ctx is done, otherwise it is
+	// abandoned and shutdown goes on.
+	Close func(ctx context.Context) error
+}
+
+// CloseError is failure of component's closer.
+type CloseError struct {
+	Name string
+	Err  error
+}
+
+// Error returns error's text
+func (e *CloseError) Error() string {
+	return "Failed to close " + e.Name + ": " + e.Err.Error()
+}
+
+// Cause returns closer's error.
+func (e *CloseError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the same error as Cause.
+func (e *CloseError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown closes registered components in reverse start order. Zero Shutdown is ready
+// to use.
+type Shutdown struct {
+	// Timeout limits whole shutdown. Zero means no limit besides context.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	closers []Closer
+	once    sync.Once
+	err     error
+}
+
+// Register adds closer. Components should be registered right after they are started.
+func (s *Shutdown) Register(c Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closers = append(s.closers, c)
+}
+
+// Add registers io.Closer with default priority and no own timeout.
+func (s *Shutdown) Add(name string, c io.Closer) {
+	s.Register(Closer{
+		Name:  name,
+		Close: func(ctx context.Context) error { return c.Close() },
+	})
+}
+
+// Wait blocks until one of signals is received or ctx is done, then closes components.
+// If no signals specified, SIGTERM and SIGINT are used. Shutdown is not canceled by ctx,
+// it is limited by Timeout only.
+func (s *Shutdown) Wait(ctx context.Context, signals ...os.Signal) error {
+	sctx, stop := notifyContext(ctx, signals)
+	<-sctx.Done()
+	stop()
+
+	return s.Close(context.WithoutCancel(ctx))
+}
+
+// notifyContext returns ctx that is done when one of signals is received, SIGTERM and
+// SIGINT are used if no signals specified.
+func notifyContext(ctx context.Context, signals []os.Signal) (context.Context, context.CancelFunc) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	return signal.NotifyContext(ctx, signals...)
+}
+
+// Close closes all registered components, one by one. Failure of one closer does not stop
+// shutdown. Returns *errors.MultiError with *CloseError of every failed closer, or nil.
+// Only first call closes components, subsequent calls return the same result.
+func (s *Shutdown) Close(ctx context.Context) error {
+	s.once.Do(func() {
+		s.err = s.close(ctx)
+	})
+	return s.err
+}
+
+func (s *Shutdown) close(ctx context.Context) error {
+	ctx, cancel := s.limit(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	closers := make([]Closer, len(s.closers))
+	copy(closers, s.closers)
+	s.mu.Unlock()
+
+	// reverse start order, then stable sort by priority
+	for i, j := 0, len(closers)-1; i < j; i, j = i+1, j-1 {
+		closers[i], closers[j] = closers[j], closers[i]
+	}
+	sort.SliceStable(closers, func(i, j int) bool {
+		return closers[i].Priority > closers[j].Priority
+	})
+
+	me := errors.NewMultiError()
+	for _, c := range closers {
+		err := closeOne(ctx, c)
+		if err != nil {
+			me.Add(&CloseError{Name: c.Name, Err: err})
+		}
+	}
+	return me.IfHasErrors()
+}
+
+// limit limits ctx with Timeout, if any.
+func (s *Shutdown) limit(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout > 0 {
+		return context.WithTimeout(ctx, s.Timeout)
+	}
+	return ctx, func() {}
+}
+
+// closeOne calls closer and waits for it no longer than its timeout.
+func closeOne(ctx context.Context, c Closer) error {
+	if c.Close == nil {
+		return nil
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "Not closed: ")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Close(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "Closer abandoned: ")
+	}
+}
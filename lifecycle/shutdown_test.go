@@ -0,0 +1,134 @@
+package lifecycle
+
+import (
+	"context"
+	std_errors "errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func TestShutdownOrder(t *testing.T) {
+	s := &Shutdown{}
+	order := []string{}
+	closer := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	s.Register(Closer{Name: "db", Close: closer("db")})
+	s.Register(Closer{Name: "cache", Close: closer("cache")})
+	s.Register(Closer{Name: "http", Close: closer("http"), Priority: 1})
+	s.Add("queue", closerFunc(func() error {
+		order = append(order, "queue")
+		return nil
+	}))
+
+	err := s.Close(context.Background())
+	if err != nil {
+		t.Fatal("Shutdown failed", err)
+	}
+	if strings.Join(order, ",") != "http,queue,cache,db" {
+		t.Fatal("Wrong order", order)
+	}
+
+	// components are closed only once
+	err = s.Close(context.Background())
+	if err != nil || len(order) != 4 {
+		t.Fatal("Components closed twice", order, err)
+	}
+}
+
+func TestShutdownErrors(t *testing.T) {
+	s := &Shutdown{}
+	closed := false
+	s.Add("db", closerFunc(func() error { closed = true; return nil }))
+	s.Add("cache", closerFunc(func() error { return io.ErrClosedPipe }))
+	s.Register(Closer{
+		Name:    "http",
+		Timeout: time.Millisecond * 50,
+		Close: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	start := time.Now()
+	err := s.Close(context.Background())
+	if time.Since(start) > time.Millisecond*500 {
+		t.Fatal("Hanging closer not abandoned")
+	}
+	if !closed {
+		t.Fatal("Shutdown stopped on failure")
+	}
+
+	me, ok := err.(*errors.MultiError)
+	if !ok || me.ActualLen() != 2 {
+		t.Fatal("Expected two failures", err)
+	}
+
+	var ce *CloseError
+	if !std_errors.As(me.Get(0), &ce) || ce.Name != "http" || !std_errors.Is(ce, context.DeadlineExceeded) {
+		t.Fatal("Expected http timeout", me.Get(0))
+	}
+	if !std_errors.As(me.Get(1), &ce) || ce.Name != "cache" || ce.Err != io.ErrClosedPipe {
+		t.Fatal("Expected cache failure", me.Get(1))
+	}
+	if !std_errors.Is(err, io.ErrClosedPipe) {
+		t.Fatal("Failure not found in error", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := &Shutdown{Timeout: time.Millisecond * 50}
+	closed := false
+	s.Add("db", closerFunc(func() error { closed = true; return nil }))
+	s.Register(Closer{
+		Name:  "http",
+		Close: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() },
+	})
+
+	err := s.Close(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Failed to close db") || closed {
+		t.Fatal("Components closed after timeout", err, closed)
+	}
+}
+
+func TestShutdownWait(t *testing.T) {
+	s := &Shutdown{}
+	closed := make(chan struct{})
+	s.Register(Closer{Name: "http", Close: func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		close(closed)
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		cancel()
+	}()
+
+	err := s.Wait(ctx)
+	if err != nil {
+		t.Fatal("Shutdown failed", err)
+	}
+	select {
+	case <-closed:
+	default:
+		t.Fatal("Component not closed")
+	}
+}
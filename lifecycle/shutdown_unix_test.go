@@ -0,0 +1,47 @@
+//go:build unix
+
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitSignal(t *testing.T) {
+	// keep signal from killing test process if it comes before Wait subscribes
+	ignored := make(chan os.Signal, 1)
+	signal.Notify(ignored, syscall.SIGUSR1)
+	defer signal.Stop(ignored)
+
+	s := &Shutdown{}
+	closed := false
+	s.Add("db", closerFunc(func() error { closed = true; return nil }))
+
+	done := make(chan error)
+	go func() {
+		done <- s.Wait(context.Background(), syscall.SIGUSR1)
+	}()
+
+	timeout := time.After(time.Second)
+	for {
+		err := syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		if err != nil {
+			t.Fatal("Can not send signal", err)
+		}
+
+		select {
+		case err = <-done:
+			if err != nil || !closed {
+				t.Fatal("Component not closed", err)
+			}
+			return
+		case <-timeout:
+			t.Fatal("Signal not handled")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
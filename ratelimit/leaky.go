@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// LeakyBucket is leaky bucket limiter used as queue: events leave bucket at constant
+// rate, without bursts. Bucket holds up to Capacity waiting events, events that do not fit
+// are rejected.
+type LeakyBucket struct {
+	interval time.Duration
+	capacity int
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewLeakyBucket creates empty leaky bucket. Rate is number of events per second,
+// capacity is number of events that can wait in bucket. Panics if rate is not positive
+// or so small that interval between events does not fit time.Duration.
+func NewLeakyBucket(rate float64, capacity int) *LeakyBucket {
+	interval := float64(time.Second) / rate
+	if !(rate > 0) || interval >= math.MaxInt64 {
+		panic(fmt.Sprintf("ratelimit: invalid leaky bucket rate %v, must be positive", rate))
+	}
+
+	return &LeakyBucket{
+		interval: time.Duration(interval),
+		capacity: capacity,
+	}
+}
+
+// Allow reports whether event may happen now, that is no events are waiting and
+// previous event left bucket at least 1/rate ago.
+func (b *LeakyBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.next.After(now) {
+		return false
+	}
+	b.next = now.Add(b.interval)
+	return true
+}
+
+// Wait blocks until event leaves bucket or ctx is done. Returns ErrLimitExceeded if
+// bucket is full or event would leave bucket after ctx's deadline.
+func (b *LeakyBucket) Wait(ctx context.Context) error {
+	return wait(ctx, b.Reserve())
+}
+
+// Reserve puts event into bucket. Reservation is not OK if bucket is full.
+func (b *LeakyBucket) Reserve() *Reservation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	at := b.next
+	if at.Before(now) {
+		at = now
+	}
+	if at.Sub(now) > time.Duration(b.capacity)*b.interval {
+		return &Reservation{}
+	}
+
+	b.next = at.Add(b.interval)
+	return &Reservation{ok: true, at: at, cancel: func() { b.cancel(at) }}
+}
+
+// cancel frees slot of event scheduled at, only last event's slot can be freed.
+func (b *LeakyBucket) cancel(at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.next.Equal(at.Add(b.interval)) {
+		b.next = at
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeakyBucketAllow(t *testing.T) {
+	b := NewLeakyBucket(10, 5)
+	if !b.Allow() {
+		t.Fatal("First event not allowed")
+	}
+	if b.Allow() {
+		t.Fatal("Burst allowed")
+	}
+
+	time.Sleep(time.Millisecond * 110)
+	if !b.Allow() {
+		t.Fatal("Event not allowed after interval")
+	}
+}
+
+func TestLeakyBucketReserve(t *testing.T) {
+	b := NewLeakyBucket(10, 2)
+	delays := []time.Duration{}
+	for i := 0; i < 3; i++ {
+		r := b.Reserve()
+		if !r.OK() {
+			t.Fatal("Event not admitted", i)
+		}
+		delays = append(delays, r.Delay())
+	}
+	if delays[0] != 0 || delays[1] < time.Millisecond*90 || delays[2] < time.Millisecond*190 {
+		t.Fatal("Wrong delays", delays)
+	}
+
+	r := b.Reserve()
+	if r.OK() {
+		t.Fatal("Event admitted to full bucket", r.Delay())
+	}
+}
+
+func TestLeakyBucketCancel(t *testing.T) {
+	b := NewLeakyBucket(10, 1)
+	b.Reserve()
+	r := b.Reserve()
+	if !r.OK() || b.Reserve().OK() {
+		t.Fatal("Wrong capacity")
+	}
+
+	r.Cancel()
+	r = b.Reserve()
+	if !r.OK() || r.Delay() > time.Millisecond*100 {
+		t.Fatal("Canceled slot not freed", r.OK(), r.Delay())
+	}
+}
+
+func TestLeakyBucketWait(t *testing.T) {
+	b := NewLeakyBucket(50, 10)
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	times := make([]time.Duration, 5)
+	for i := range times {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := b.Wait(context.Background())
+			if err != nil {
+				t.Error("Wait failed", err)
+			}
+			times[i] = time.Since(start)
+		}(i)
+	}
+	wg.Wait()
+
+	max := time.Duration(0)
+	for _, d := range times {
+		if d > max {
+			max = d
+		}
+	}
+	if max < time.Millisecond*75 {
+		t.Fatal("Events not spread", times)
+	}
+
+	b = NewLeakyBucket(10, 0)
+	b.Reserve()
+	if err := b.Wait(context.Background()); err != ErrLimitExceeded {
+		t.Fatal("Wait on full bucket must fail", err)
+	}
+}
+
+func TestNewLeakyBucketInvalidRate(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN(), 1e-12} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Invalid rate accepted", rate)
+				}
+			}()
+			NewLeakyBucket(rate, 1)
+		}()
+	}
+}
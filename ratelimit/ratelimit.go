@@ -0,0 +1,80 @@
+// Package ratelimit provides context-aware token bucket and leaky bucket limiters.
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// ErrLimitExceeded is returned by Wait when event can not be admitted: leaky bucket
+// is full or event would be admitted after context's deadline.
+var ErrLimitExceeded = errors.New("Rate limit exceeded")
+
+// Limiter limits rate of events.
+type Limiter interface {
+	// Allow reports whether event may happen now. Event is admitted if true is returned.
+	Allow() bool
+	// Wait blocks until event is admitted or ctx is done.
+	Wait(ctx context.Context) error
+	// Reserve admits event in the future, caller must wait for Reservation's Delay
+	// before acting or cancel reservation.
+	Reserve() *Reservation
+}
+
+// Reservation is event admitted by limiter at some time.
+type Reservation struct {
+	ok     bool
+	at     time.Time
+	cancel func()
+}
+
+// OK reports whether event is admitted. If false, Delay and Cancel have no meaning.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns time caller must wait before acting.
+func (r *Reservation) Delay() time.Duration {
+	d := time.Until(r.at)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Cancel returns reservation to limiter, so other events can be admitted earlier.
+// Reservations which time has passed can not be canceled.
+func (r *Reservation) Cancel() {
+	if r.ok && r.cancel != nil && time.Now().Before(r.at) {
+		r.cancel()
+	}
+	r.cancel = nil
+}
+
+// wait waits for reservation made by reserve, canceling it if ctx is done before.
+func wait(ctx context.Context, r *Reservation) error {
+	if !r.ok {
+		return ErrLimitExceeded
+	}
+
+	d := r.Delay()
+	if d == 0 {
+		return nil
+	}
+	if dl, ok := ctx.Deadline(); ok && dl.Before(r.at) {
+		r.Cancel()
+		return ErrLimitExceeded
+	}
+
+	t := time.NewTimer(d)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		r.Cancel()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket is token bucket limiter: bucket holds up to Burst tokens and is refilled
+// with Rate tokens per second, every event takes one token. Bursts are allowed while
+// bucket has tokens.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates full token bucket. Rate is number of tokens added per second,
+// burst is bucket size (at least 1). Zero rate allows only initial burst. Panics if rate is
+// negative or not finite.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if !(rate >= 0) || math.IsInf(rate, 1) {
+		panic(fmt.Sprintf("ratelimit: invalid token bucket rate %v, must not be negative", rate))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow reports whether event may happen now.
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Wait blocks until event is admitted or ctx is done. Returns ErrLimitExceeded without
+// waiting if event would be admitted after ctx's deadline.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return wait(ctx, b.Reserve())
+}
+
+// Reserve takes token, possibly from the future. Reservation is not OK only if rate is
+// zero and bucket is empty.
+func (b *TokenBucket) Reserve() *Reservation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refill(now)
+
+	if b.tokens < 1 && b.rate <= 0 {
+		return &Reservation{}
+	}
+
+	b.tokens--
+	at := now
+	if b.tokens < 0 {
+		at = now.Add(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	}
+	return &Reservation{ok: true, at: at, cancel: b.cancel}
+}
+
+func (b *TokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
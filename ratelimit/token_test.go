@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	b := NewTokenBucket(10, 3)
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatal("Burst not allowed", i)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("Allowed over burst")
+	}
+
+	time.Sleep(time.Millisecond * 120)
+	if !b.Allow() {
+		t.Fatal("Bucket not refilled")
+	}
+	if b.Allow() {
+		t.Fatal("Bucket refilled too fast")
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := NewTokenBucket(10, 1)
+	r := b.Reserve()
+	if !r.OK() || r.Delay() != 0 {
+		t.Fatal("First reservation must not wait", r.Delay())
+	}
+
+	r = b.Reserve()
+	if !r.OK() || r.Delay() < time.Millisecond*80 || r.Delay() > time.Millisecond*100 {
+		t.Fatal("Wrong delay", r.Delay())
+	}
+	r.Cancel()
+
+	r = b.Reserve()
+	if r.Delay() > time.Millisecond*100 {
+		t.Fatal("Canceled reservation not returned", r.Delay())
+	}
+
+	b = NewTokenBucket(0, 1)
+	if !b.Reserve().OK() {
+		t.Fatal("Token from full bucket not reserved")
+	}
+	if b.Reserve().OK() {
+		t.Fatal("Reserved token that will never be added")
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	b := NewTokenBucket(20, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		err := b.Wait(context.Background())
+		if err != nil {
+			t.Fatal("Wait failed", err)
+		}
+	}
+	if el := time.Since(start); el < time.Millisecond*90 {
+		t.Fatal("Wait did not limit rate", el)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	start = time.Now()
+	err := b.Wait(ctx)
+	if err != ErrLimitExceeded || time.Since(start) > time.Millisecond*5 {
+		t.Fatal("Wait past deadline must fail immediately", err)
+	}
+
+	// failed wait must not take token
+	time.Sleep(time.Millisecond * 60)
+	if !b.Allow() {
+		t.Fatal("Token taken by failed wait")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		cancel()
+	}()
+	err = b.Wait(ctx)
+	if err != context.Canceled {
+		t.Fatal("Wait not canceled", err)
+	}
+}
+
+func TestNewTokenBucketInvalidRate(t *testing.T) {
+	for _, rate := range []float64{-1, math.NaN(), math.Inf(1)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Invalid rate accepted", rate)
+				}
+			}()
+			NewTokenBucket(rate, 1)
+		}()
+	}
+
+	b := NewTokenBucket(0, 1)
+	if !b.Allow() || b.Allow() {
+		t.Fatal("Zero rate bucket must allow only burst")
+	}
+}
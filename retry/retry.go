@@ -0,0 +1,143 @@
+// Package retry calls functions until they succeed, with attempts limit, elapsed time
+// limit, exponential backoff with jitter and retryable error predicate.
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// Policy describes how function is retried. Zero Policy retries immediately until
+// function succeeds or context is done.
+type Policy struct {
+	// MaxAttempts limits number of attempts. Zero means no limit.
+	MaxAttempts int
+	// MaxElapsed limits time since first attempt, no attempt is started after it.
+	// Zero means no limit besides context.
+	MaxElapsed time.Duration
+	// Delay is pause after first failed attempt.
+	Delay time.Duration
+	// MaxDelay limits pause between attempts. Zero means no limit.
+	MaxDelay time.Duration
+	// Multiplier increases pause after every failed attempt. Values less than 1
+	// mean constant pause.
+	Multiplier float64
+	// Jitter is fraction of pause that is randomized, from 0 (no jitter) to 1
+	// (pause is random value from 0 to computed pause).
+	Jitter float64
+	// Retryable tells whether attempt's error can go away on retry. If nil, all
+	// errors are retried.
+	Retryable func(err error) bool
+	// Wake if not nil starts next attempt right away when it receives value or
+	// is closed, without waiting for the end of pause.
+	Wake <-chan struct{}
+	// MaxErrors limits number of attempt errors kept in returned error, errors of
+	// earliest attempts are dropped. Zero means all errors are kept.
+	MaxErrors int
+}
+
+// Backoff returns pause after attempt-th failed attempt (starting from 1), without jitter.
+func (p *Policy) Backoff(attempt int) time.Duration {
+	d := float64(p.Delay)
+	if p.Multiplier > 1 {
+		d *= math.Pow(p.Multiplier, float64(attempt-1))
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	if d > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(d)
+}
+
+func (p *Policy) pause(attempt int) time.Duration {
+	d := p.Backoff(attempt)
+	if p.Jitter <= 0 || d <= 0 {
+		return d
+	}
+
+	j := p.Jitter
+	if j > 1 {
+		j = 1
+	}
+	return d - time.Duration(float64(d)*j*rand.Float64())
+}
+
+// Do calls fn until it succeeds, returns non retryable error, attempts or elapsed time
+// are exhausted or ctx is done. First attempt is always made. Returns fn's result and
+// nil on success. On failure returns zero result and *errors.MultiError with errors of
+// attempts, last one is the error of last attempt (see Last).
+func Do[T any](ctx context.Context, p Policy, fn func(ctx context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	var errs []error
+
+	for attempt := 1; ; attempt++ {
+		res, err := fn(ctx)
+		if err == nil {
+			return res, nil
+		}
+
+		errs = append(errs, err)
+		if p.MaxErrors > 0 && len(errs) > p.MaxErrors {
+			errs = errs[len(errs)-p.MaxErrors:]
+		}
+
+		if !p.retry(ctx, start, attempt, err) {
+			var zero T
+			return zero, errors.NewMultiError(errs...)
+		}
+	}
+}
+
+// retry waits for the next attempt, returns false if there will be no next attempt.
+func (p *Policy) retry(ctx context.Context, start time.Time, attempt int, err error) bool {
+	if p.Retryable != nil && !p.Retryable(err) {
+		return false
+	}
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return false
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	pause := p.pause(attempt)
+	if p.MaxElapsed > 0 && time.Since(start)+pause >= p.MaxElapsed {
+		return false
+	}
+
+	t := time.NewTimer(pause)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		return false
+	case <-p.Wake:
+		t.Stop()
+	case <-t.C:
+	}
+	// select picks any ready case, ctx may be done as well
+	return ctx.Err() == nil
+}
+
+// Run is Do for functions without result.
+func Run(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	_, err := Do(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Last returns error of last attempt from error returned by Do or Run. Other errors are
+// returned as is.
+func Last(err error) error {
+	me, ok := err.(*errors.MultiError)
+	if !ok || me.AddedLen() == 0 {
+		return err
+	}
+	return me.Get(me.AddedLen() - 1)
+}
@@ -0,0 +1,127 @@
+package retry
+
+import (
+	"context"
+	std_errors "errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+func TestDo(t *testing.T) {
+	attempts := 0
+	res, err := Do(context.Background(), Policy{Delay: time.Millisecond}, func(ctx context.Context) (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "", errors.Newf("attempt %d failed", attempts)
+		}
+		return "ok", nil
+	})
+	if err != nil || res != "ok" || attempts != 3 {
+		t.Fatal("Wrong result", res, err, attempts)
+	}
+}
+
+func TestDoMaxAttempts(t *testing.T) {
+	attempts := 0
+	res, err := Do(context.Background(), Policy{MaxAttempts: 3}, func(ctx context.Context) (int, error) {
+		attempts++
+		return attempts, errors.Wrapf(io.EOF, "attempt %d: ", attempts)
+	})
+	if err == nil || res != 0 || attempts != 3 {
+		t.Fatal("Wrong result", res, err, attempts)
+	}
+
+	me, ok := err.(*errors.MultiError)
+	if !ok || me.ActualLen() != 3 || err.Error() != "attempt 1: EOF; attempt 2: EOF; attempt 3: EOF; " {
+		t.Fatal("Wrong error", err)
+	}
+	if !std_errors.Is(err, io.EOF) || Last(err).Error() != "attempt 3: EOF" {
+		t.Fatal("Wrong last error", Last(err))
+	}
+}
+
+func TestDoRetryable(t *testing.T) {
+	fatal := errors.New("fatal")
+	attempts := 0
+	err := Run(context.Background(), Policy{Retryable: func(err error) bool { return err != fatal }},
+		func(ctx context.Context) error {
+			attempts++
+			if attempts == 2 {
+				return fatal
+			}
+			return io.ErrUnexpectedEOF
+		})
+	if Last(err) != fatal || attempts != 2 {
+		t.Fatal("Non retryable error was retried", err, attempts)
+	}
+}
+
+func TestDoElapsed(t *testing.T) {
+	start := time.Now()
+	err := Run(context.Background(), Policy{MaxElapsed: time.Millisecond * 100, Delay: time.Millisecond * 10, MaxErrors: 2},
+		func(ctx context.Context) error {
+			return io.EOF
+		})
+	if err == nil || time.Since(start) > time.Millisecond*200 {
+		t.Fatal("Elapsed time not limited", err, time.Since(start))
+	}
+	if err.(*errors.MultiError).AddedLen() != 2 {
+		t.Fatal("Errors not limited", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start = time.Now()
+	err = Run(ctx, Policy{Delay: time.Hour}, func(ctx context.Context) error {
+		return io.EOF
+	})
+	if err == nil || time.Since(start) > time.Millisecond*200 {
+		t.Fatal("Context not respected", err, time.Since(start))
+	}
+}
+
+func TestDoWake(t *testing.T) {
+	wake := make(chan struct{})
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		wake <- struct{}{}
+	}()
+
+	attempts := 0
+	start := time.Now()
+	err := Run(context.Background(), Policy{Delay: time.Hour, Wake: wake}, func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil || time.Since(start) > time.Second {
+		t.Fatal("Wake ignored", err, time.Since(start))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Delay: time.Millisecond * 100, Multiplier: 2, MaxDelay: time.Second}
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, e := range expected {
+		if d := p.Backoff(i + 1); d != e*time.Millisecond {
+			t.Fatal("Wrong backoff", i+1, d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.pause(2)
+		if d < time.Millisecond*100 || d > time.Millisecond*200 {
+			t.Fatal("Wrong jitter", d)
+		}
+	}
+
+	if (&Policy{Delay: time.Hour, Multiplier: 10}).Backoff(100) <= 0 {
+		t.Fatal("Backoff overflow")
+	}
+}
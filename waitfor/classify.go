@@ -0,0 +1,115 @@
+package waitfor
+
+import (
+	std_errors "errors"
+	"net"
+	"os/exec"
+	"syscall"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// Error classes.
+const (
+	// Retryable errors can go away on retry: connection refused, timeouts,
+	// temporary DNS failures and so on.
+	Retryable ErrorClass = iota
+	// Permanent errors will not go away on retry: permission denied, invalid address,
+	// rejected credentials, missing gRPC health service. Wait fails on them immediately.
+	Permanent
+)
+
+// ErrorClass tells whether probe's error can go away on retry.
+type ErrorClass int
+
+// Classifier classifies probe's errors.
+type Classifier func(err error) ErrorClass
+
+// String returns class name.
+func (c ErrorClass) String() string {
+	if c == Permanent {
+		return "permanent"
+	}
+	return "retryable"
+}
+
+// ClassifyError is default Classifier. Errors are treated as retryable unless they are known
+// to be permanent. "No such host" is retryable, because names in compose or Kubernetes networks
+// are registered only when container is up, see ClassifyNotFoundPermanent to fail fast on it.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return Retryable
+	}
+
+	// aggregated error (e.g. from SRV members) is permanent only if all its errors are,
+	// empty one tells nothing and is retried
+	var me *errors.MultiError
+	if std_errors.As(err, &me) {
+		if me.ActualLen() == 0 {
+			return Retryable
+		}
+		for _, e := range me.Unwrap() {
+			if ClassifyError(e) == Retryable {
+				return Retryable
+			}
+		}
+		return Permanent
+	}
+
+	var sqlErr *SQLError
+	if std_errors.As(err, &sqlErr) {
+		if sqlErr.Kind == SQLRejected {
+			return Permanent
+		}
+		return Retryable
+	}
+
+	var healthErr *HealthError
+	if std_errors.As(err, &healthErr) {
+		switch healthErr.Code {
+		case grpcUnimplemented, grpcUnauthenticated, grpcPermissionDenied:
+			return Permanent
+		}
+		return Retryable
+	}
+
+	var sigErr *signalError
+	if std_errors.As(err, &sigErr) {
+		return Permanent
+	}
+
+	var resolveErr *ResolveError
+	if std_errors.As(err, &resolveErr) {
+		return Retryable
+	}
+
+	var addrErr *net.AddrError
+	if std_errors.As(err, &addrErr) {
+		return Permanent
+	}
+
+	var netErr net.UnknownNetworkError
+	if std_errors.As(err, &netErr) {
+		return Permanent
+	}
+
+	if std_errors.Is(err, syscall.EACCES) || std_errors.Is(err, syscall.EPERM) ||
+		std_errors.Is(err, exec.ErrNotFound) || std_errors.Is(err, std_errors.ErrUnsupported) {
+		return Permanent
+	}
+
+	return Retryable
+}
+
+// ClassifyNotFoundPermanent is ClassifyError that treats "no such host" as permanent, so that
+// misspelled host name fails wait immediately. Use it if all names are registered before wait
+// starts.
+func ClassifyNotFoundPermanent(err error) ErrorClass {
+	var resolveErr *ResolveError
+	var dnsErr *net.DNSError
+	if !std_errors.As(err, &resolveErr) && std_errors.As(err, &dnsErr) &&
+		dnsErr.IsNotFound && !dnsErr.IsTemporary && !dnsErr.IsTimeout {
+		return Permanent
+	}
+	return ClassifyError(err)
+}
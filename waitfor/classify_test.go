@@ -0,0 +1,92 @@
+package waitfor
+
+import (
+	"context"
+	std_errors "errors"
+	"net"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{errors.New("some"), Retryable},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, Retryable},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, Retryable},
+		{&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}, Retryable},
+		{&net.OpError{Op: "dial", Err: &net.AddrError{Err: "invalid port", Addr: "364589"}}, Permanent},
+		{&net.OpError{Op: "dial", Err: syscall.EACCES}, Permanent},
+		{errors.Wrap(&net.OpError{Op: "dial", Err: syscall.EPERM}, "wrapped: "), Permanent},
+		{&ResolveError{Host: "db", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, Retryable},
+		{&SQLError{Kind: SQLRejected, Err: errors.New("access denied")}, Permanent},
+		{&SQLError{Kind: SQLUnreachable, Err: errors.New("access denied")}, Retryable},
+		{&CommandError{Command: "none", Err: exec.ErrNotFound}, Permanent},
+		{context.DeadlineExceeded, Retryable},
+		{errors.Wrap(std_errors.ErrUnsupported, "h2c: "), Permanent},
+		{errors.NewMultiError(&net.OpError{Op: "dial", Err: syscall.EACCES}, syscall.ECONNREFUSED), Retryable},
+		{errors.Wrap(errors.NewMultiError(syscall.EACCES, syscall.EPERM), "members: "), Permanent},
+		{errors.Wrap(errors.NewMultiError(), "1 of 1 members ready, required 2: "), Retryable},
+	}
+
+	for i, c := range cases {
+		if ClassifyError(c.err) != c.class {
+			t.Fatal("Wrong class", i, c.err, ClassifyError(c.err))
+		}
+	}
+}
+
+func TestClassifyNotFoundPermanent(t *testing.T) {
+	notFound := &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}
+	if ClassifyNotFoundPermanent(notFound) != Permanent {
+		t.Fatal("Not found host is retryable")
+	}
+	if ClassifyNotFoundPermanent(&ResolveError{Host: "db", Err: notFound.Err}) != Retryable {
+		t.Fatal("DNSProbe's error is permanent")
+	}
+	if ClassifyNotFoundPermanent(&net.DNSError{Err: "server misbehaving", IsTemporary: true}) != Retryable {
+		t.Fatal("Temporary DNS error is permanent")
+	}
+
+	w := &Waiter{Timeout: time.Second * 5, RetryAfter: time.Millisecond * 100, Classify: ClassifyNotFoundPermanent}
+	start := time.Now()
+	err := w.WaitTCPPort(context.Background(), "host.invalid", "80")
+	if err == nil || !strings.Contains(err.Error(), "not resolved, not retrying") {
+		t.Fatal("Expected permanent error", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Not found host was retried", time.Since(start))
+	}
+}
+
+func TestWaitPermanent(t *testing.T) {
+	start := time.Now()
+	err := WaitTCPPort(time.Second*5, time.Millisecond*100, "localhost", "364589")
+	if err == nil || !strings.Contains(err.Error(), "not retrying") {
+		t.Fatal("Expected permanent error", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Permanent error was retried", time.Since(start))
+	}
+
+	w := &Waiter{
+		Timeout:    time.Millisecond * 300,
+		RetryAfter: time.Millisecond * 100,
+		Classify:   func(err error) ErrorClass { return Retryable },
+	}
+	start = time.Now()
+	err = w.WaitTCPPort(context.Background(), "localhost", "364589")
+	if err == nil || strings.Contains(err.Error(), "not retrying") {
+		t.Fatal("Expected retryable error", err)
+	}
+	if time.Since(start) < time.Millisecond*300 {
+		t.Fatal("Custom classifier not used")
+	}
+}
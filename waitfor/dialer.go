@@ -0,0 +1,416 @@
+package waitfor
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	std_errors "errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// Dialer connects to the address on the named network. *net.Dialer implements Dialer.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+var socks5Errors = []string{
+	"",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+func dialer(d Dialer) Dialer {
+	if d == nil {
+		return &net.Dialer{}
+	}
+	return d
+}
+
+// SOCKS5Dialer connects to addresses through SOCKS5 proxy. Host names are resolved
+// by proxy unless ResolveLocally is set.
+type SOCKS5Dialer struct {
+	// ProxyAddr is proxy address in host:port form.
+	ProxyAddr string
+	// Username and Password are used if proxy requires authentication. Both are limited
+	// to 255 bytes.
+	Username string
+	Password string
+	// ResolveLocally resolves host names before they are sent to proxy, as socks5:// proxy
+	// urls require. Otherwise host names are resolved by proxy, as socks5h:// urls require.
+	ResolveLocally bool
+	// Forward is used to connect to proxy. If nil, direct connection is used.
+	Forward Dialer
+}
+
+// DialContext connects to address through proxy. Only tcp networks are supported.
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.New("Wrong port in address " + address)
+	}
+	if len(d.Username) > 255 || len(d.Password) > 255 {
+		return nil, errors.New("SOCKS5 username and password must not be longer than 255 bytes")
+	}
+
+	if net.ParseIP(host) == nil {
+		if d.ResolveLocally {
+			host, err = resolve(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+		} else if len(host) > 255 {
+			return nil, errors.New("SOCKS5 host name must not be longer than 255 bytes: " + host)
+		}
+	}
+
+	conn, err := dialer(d.Forward).DialContext(ctx, network, d.ProxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withDeadline(ctx, conn, func() error {
+		return d.connect(conn, host, uint16(port))
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "SOCKS5 proxy %s can not connect to %s: ", d.ProxyAddr, address)
+	}
+	return conn, nil
+}
+
+func (d *SOCKS5Dialer) connect(conn net.Conn, host string, port uint16) error {
+	method := byte(0)
+	if d.Username != "" {
+		method = 2
+	}
+
+	_, err := conn.Write([]byte{5, 1, method})
+	if err != nil {
+		return err
+	}
+
+	resp := make([]byte, 2)
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		return err
+	}
+	if resp[0] != 5 || resp[1] != method {
+		return errors.New("authentication method not accepted")
+	}
+
+	if method == 2 {
+		auth := []byte{1, byte(len(d.Username))}
+		auth = append(auth, d.Username...)
+		auth = append(auth, byte(len(d.Password)))
+		auth = append(auth, d.Password...)
+		_, err = conn.Write(auth)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.ReadFull(conn, resp)
+		if err != nil {
+			return err
+		}
+		if resp[1] != 0 {
+			return errors.New("authentication failed")
+		}
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, 1)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, 4)
+		req = append(req, ip...)
+	}
+	req = binary.BigEndian.AppendUint16(req, port)
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	// reply: version, status, reserved, address type, bound address, bound port
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		if int(reply[1]) < len(socks5Errors) {
+			return errors.New(socks5Errors[reply[1]])
+		}
+		return errors.Newf("unknown error %d", reply[1])
+	}
+
+	var skip int
+	switch reply[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		l := make([]byte, 1)
+		_, err = io.ReadFull(conn, l)
+		if err != nil {
+			return err
+		}
+		skip = int(l[0])
+	default:
+		return errors.New("unknown address type in reply")
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// resolve returns host's address, IPv4 addresses are preferred.
+func resolve(ctx context.Context, host string) (string, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			return a.IP.String(), nil
+		}
+	}
+	return addrs[0].IP.String(), nil
+}
+
+// HTTPConnectDialer connects to addresses through HTTP proxy using CONNECT method.
+type HTTPConnectDialer struct {
+	// ProxyURL is proxy's url with http or https scheme. User info (if any)
+	// is sent with Proxy-Authorization header.
+	ProxyURL *url.URL
+	// TLSConfig is used for https proxies.
+	TLSConfig *tls.Config
+	// Forward is used to connect to proxy. If nil, direct connection is used.
+	Forward Dialer
+}
+
+// DialContext connects to address through proxy. Only tcp networks are supported.
+func (d *HTTPConnectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.ProxyURL == nil {
+		return nil, errors.New("HTTP proxy url is not set")
+	}
+
+	proxyAddr := d.ProxyURL.Host
+	if d.ProxyURL.Port() == "" {
+		if d.ProxyURL.Scheme == "https" {
+			proxyAddr += ":443"
+		} else {
+			proxyAddr += ":80"
+		}
+	}
+
+	conn, err := dialer(d.Forward).DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ProxyURL.Scheme == "https" {
+		cfg := &tls.Config{}
+		if d.TLSConfig != nil {
+			cfg = d.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = d.ProxyURL.Hostname()
+		}
+		conn = tls.Client(conn, cfg)
+	}
+
+	var br *bufio.Reader
+	err = withDeadline(ctx, conn, func() error {
+		br, err = d.connect(conn, address)
+		return err
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "HTTP proxy %s can not connect to %s: ", proxyAddr, address)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+func (d *HTTPConnectDialer) connect(conn net.Conn, address string) (*bufio.Reader, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if u := d.ProxyURL.User; u != nil {
+		pass, _ := u.Password()
+		cred := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+
+	err := req.Write(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("proxy responded " + resp.Status)
+	}
+	return br, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// ProxyFromEnvironment returns Dialer configured from ALL_PROXY or HTTPS_PROXY environment
+// variables (or their lowercase versions), ALL_PROXY takes precedence. Supported proxy
+// schemes are socks5, socks5h, http and https. Addresses listed in NO_PROXY are dialed
+// directly. If no proxy is configured, direct Dialer is returned.
+func ProxyFromEnvironment() (Dialer, error) {
+	proxy := getEnv("ALL_PROXY", "all_proxy")
+	if proxy == "" {
+		proxy = getEnv("HTTPS_PROXY", "https_proxy")
+	}
+	if proxy == "" {
+		return &net.Dialer{}, nil
+	}
+
+	d, err := ProxyDialer(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	noProxy := getEnv("NO_PROXY", "no_proxy")
+	if noProxy == "" {
+		return d, nil
+	}
+	return &noProxyDialer{proxy: d, direct: &net.Dialer{}, noProxy: strings.Split(noProxy, ",")}, nil
+}
+
+// ProxyDialer returns Dialer for proxy url with socks5, socks5h, http or https scheme.
+func ProxyDialer(proxy string) (Dialer, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		// url.Error contains url itself
+		var urlErr *url.Error
+		if std_errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, errors.Wrapf(err, "Can not parse proxy url %s: ", Redact(proxy))
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		d := &SOCKS5Dialer{ProxyAddr: u.Host, ResolveLocally: u.Scheme == "socks5"}
+		if u.Port() == "" {
+			d.ProxyAddr += ":1080"
+		}
+		if u.User != nil {
+			d.Username = u.User.Username()
+			d.Password, _ = u.User.Password()
+		}
+		return d, nil
+	case "http", "https":
+		return &HTTPConnectDialer{ProxyURL: u}, nil
+	}
+	return nil, errors.New("Unsupported proxy scheme: " + u.Scheme)
+}
+
+type noProxyDialer struct {
+	proxy   Dialer
+	direct  Dialer
+	noProxy []string
+}
+
+func (d *noProxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, np := range d.noProxy {
+		np = strings.ToLower(strings.TrimSpace(np))
+		if np == "" {
+			continue
+		}
+		if np == "*" || host == strings.TrimPrefix(np, ".") ||
+			strings.HasSuffix(host, "."+strings.TrimPrefix(np, ".")) {
+			return d.direct.DialContext(ctx, network, address)
+		}
+	}
+	return d.proxy.DialContext(ctx, network, address)
+}
+
+func getEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// closeOnDone closes conn when ctx is done, so reads and writes blocked on conn return
+// even if ctx has no deadline. Returned function must be called once when conn is no longer
+// read or written, it returns ctx's error if conn was closed because of ctx and err otherwise.
+func closeOnDone(ctx context.Context, conn net.Conn) func(err error) error {
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	return func(err error) error {
+		if !stop() {
+			return ctx.Err()
+		}
+		return err
+	}
+}
+
+// withDeadline calls f, that reads and writes conn, within ctx's deadline. Conn is closed
+// if ctx is done before f returns.
+func withDeadline(ctx context.Context, conn net.Conn, f func() error) error {
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+		defer conn.SetDeadline(time.Time{})
+	}
+	done := closeOnDone(ctx, conn)
+	return done(f())
+}
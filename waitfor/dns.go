@@ -0,0 +1,99 @@
+package waitfor
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// Record types supported by DNSProbe.
+const (
+	// RecordIP is A or AAAA record.
+	RecordIP = "ip"
+	// RecordA is A record.
+	RecordA = "ip4"
+	// RecordAAAA is AAAA record.
+	RecordAAAA = "ip6"
+	// RecordSRV is SRV record, DNSProbe.Host must be full SRV name (_service._proto.name).
+	RecordSRV = "srv"
+)
+
+// DNSProbe checks that host name can be resolved.
+type DNSProbe struct {
+	// Host is name to resolve.
+	Host string
+	// Type is one of Record* constants. Default is RecordIP.
+	Type string
+	// MinRecords is minimum number of records name must be resolved to. Default is 1.
+	MinRecords int
+	// Resolver is used for lookups. If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+}
+
+// ResolveError is returned by DNSProbe when name can not be resolved or resolved to
+// less records than required.
+type ResolveError struct {
+	Host     string
+	Type     string
+	Found    int
+	Expected int
+	Err      error
+}
+
+// Error returns error's text
+func (e *ResolveError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("Can not resolve %s (%s): %v", e.Host, e.Type, e.Err)
+	}
+	return fmt.Sprintf("Host %s resolved to %d %s records, expected at least %d",
+		e.Host, e.Found, e.Type, e.Expected)
+}
+
+// Cause returns resolver's error, if any.
+func (e *ResolveError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the same error as Cause.
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// Probe resolves host name.
+func (p *DNSProbe) Probe(ctx context.Context) error {
+	r := p.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	t := p.Type
+	if t == "" {
+		t = RecordIP
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if t == RecordSRV {
+		var srvs []*net.SRV
+		_, srvs, err = r.LookupSRV(ctx, "", "", p.Host)
+		n = len(srvs)
+	} else {
+		var ips []net.IP
+		ips, err = r.LookupIP(ctx, t, p.Host)
+		n = len(ips)
+	}
+	if err != nil {
+		return &ResolveError{Host: p.Host, Type: t, Err: err}
+	}
+
+	min := p.MinRecords
+	if min <= 0 {
+		min = 1
+	}
+	if n < min {
+		return &ResolveError{Host: p.Host, Type: t, Found: n, Expected: min}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package waitfor
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsTypeSRV  = 33
+)
+
+// dnsStub is minimal DNS server answering from records map. Records are keyed
+// by lowercase fqdn and query type, values are raw rdata.
+type dnsStub struct {
+	mu      sync.Mutex
+	records map[string]map[uint16][][]byte
+	conn    net.PacketConn
+}
+
+func startDNSStub(t *testing.T) *dnsStub {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &dnsStub{
+		records: map[string]map[uint16][][]byte{},
+		conn:    conn,
+	}
+	go s.serve()
+	return s
+}
+
+func (s *dnsStub) Close() {
+	s.conn.Close()
+}
+
+func (s *dnsStub) Resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *dnsStub) AddA(name string, ip net.IP) {
+	s.add(name, dnsTypeA, ip.To4())
+}
+
+func (s *dnsStub) AddSRV(name string, port uint16, target string) {
+	rdata := make([]byte, 6)
+	binary.BigEndian.PutUint16(rdata[4:], port)
+	s.add(name, dnsTypeSRV, append(rdata, encodeDNSName(target)...))
+}
+
+func (s *dnsStub) add(name string, qtype uint16, rdata []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = strings.ToLower(name)
+	if s.records[name] == nil {
+		s.records[name] = map[uint16][][]byte{}
+	}
+	s.records[name][qtype] = append(s.records[name][qtype], rdata)
+}
+
+func (s *dnsStub) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		resp := s.answer(buf[:n])
+		if resp != nil {
+			_, _ = s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *dnsStub) answer(req []byte) []byte {
+	if len(req) < 12 {
+		return nil
+	}
+
+	// question: name labels, type, class
+	off := 12
+	labels := []string{}
+	for off < len(req) && req[off] != 0 {
+		l := int(req[off])
+		if off+1+l > len(req) {
+			return nil
+		}
+		labels = append(labels, string(req[off+1:off+1+l]))
+		off += 1 + l
+	}
+	off++
+	if off+4 > len(req) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(req[off:])
+	qend := off + 4
+	name := strings.ToLower(strings.Join(labels, ".") + ".")
+
+	s.mu.Lock()
+	types, found := s.records[name]
+	answers := types[qtype]
+	s.mu.Unlock()
+
+	resp := make([]byte, 12, 512)
+	copy(resp, req[:2])
+	flags := uint16(0x8180)
+	if !found {
+		flags |= 3 // NXDOMAIN
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+	resp = append(resp, req[12:qend]...)
+
+	for _, rdata := range answers {
+		rr := make([]byte, 12)
+		binary.BigEndian.PutUint16(rr, 0xc00c)
+		binary.BigEndian.PutUint16(rr[2:], qtype)
+		binary.BigEndian.PutUint16(rr[4:], 1)
+		binary.BigEndian.PutUint32(rr[6:], 60)
+		binary.BigEndian.PutUint16(rr[10:], uint16(len(rdata)))
+		resp = append(resp, rr...)
+		resp = append(resp, rdata...)
+	}
+	return resp
+}
+
+func encodeDNSName(name string) []byte {
+	b := []byte{}
+	for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(l)))
+		b = append(b, l...)
+	}
+	return append(b, 0)
+}
+
+func TestDNSProbe(t *testing.T) {
+	stub := startDNSStub(t)
+	defer stub.Close()
+
+	stub.AddA("db.test.", net.IPv4(10, 0, 0, 1))
+	stub.AddA("db.test.", net.IPv4(10, 0, 0, 2))
+
+	err := WaitProbe(time.Second, time.Millisecond*100, &DNSProbe{
+		Host:       "db.test.",
+		Type:       RecordA,
+		MinRecords: 2,
+		Resolver:   stub.Resolver(),
+	})
+	if err != nil {
+		t.Fatal("Host not resolved", err)
+	}
+
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*100, &DNSProbe{
+		Host:       "db.test.",
+		Type:       RecordA,
+		MinRecords: 3,
+		Resolver:   stub.Resolver(),
+	})
+	rerr, ok := err.(*ResolveError)
+	if !ok || rerr.Found != 2 || rerr.Expected != 3 {
+		t.Fatal("Wrong resolve error", err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		stub.AddSRV("_pg._tcp.late.test.", 5432, "db.test.")
+	}()
+
+	err = WaitProbe(time.Second, time.Millisecond*50, &DNSProbe{
+		Host:     "_pg._tcp.late.test.",
+		Type:     RecordSRV,
+		Resolver: stub.Resolver(),
+	})
+	if err != nil {
+		t.Fatal("SRV not resolved", err)
+	}
+}
+
+func TestWaitNotResolved(t *testing.T) {
+	// name that is not registered yet is retried by default
+	start := time.Now()
+	err := WaitTCPPort(time.Millisecond*300, time.Millisecond*100, "host.invalid", "80")
+	if err == nil || !strings.Contains(err.Error(), "not resolved") || strings.Contains(err.Error(), "not retrying") {
+		t.Fatal("Expected DNS error", err)
+	}
+	if time.Since(start) < time.Millisecond*250 {
+		t.Fatal("Not found host was not retried", time.Since(start))
+	}
+}
@@ -0,0 +1,177 @@
+package waitfor
+
+import (
+	"bytes"
+	"context"
+	std_errors "errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const commandOutputTail = 512
+
+// CommandProbe runs command and treats service as ready if command exits with code 0
+// or if command's stdout matches Match. Command is started in its own process group,
+// whole group is killed when attempt is over (on Unix systems other than Linux only when
+// attempt is canceled). On Windows there is no process group cleanup: only command itself
+// is killed when attempt is canceled, its children keep running. Single run is limited by
+// Waiter's AttemptTimeout.
+type CommandProbe struct {
+	// Path is command to run, it is looked up in PATH if it has no separators.
+	Path string
+	// Args are command's arguments (without command itself).
+	Args []string
+	// Env is added to current process environment.
+	Env []string
+	// Dir is command's working directory. If empty, current directory is used.
+	Dir string
+	// Match if not nil is matched against command's stdout, command that exits with
+	// non zero code is successful if its stdout matches.
+	Match *regexp.Regexp
+}
+
+// CommandError describes failed command run.
+type CommandError struct {
+	Command  string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Err      error
+}
+
+// Error returns error's text
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("Command %q failed", e.Command)
+	if e.ExitCode >= 0 {
+		msg += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Stderr != "" {
+		msg += ", stderr: " + e.Stderr
+	}
+	return msg
+}
+
+// Cause returns error returned by os/exec.
+func (e *CommandError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the same error as Cause.
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Probe runs command once.
+func (p *CommandProbe) Probe(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.Dir = p.Dir
+	if len(p.Env) > 0 {
+		cmd.Env = append(os.Environ(), p.Env...)
+	}
+
+	stdout, stderr, err := p.run(cmd)
+	if err != nil && stdout == nil {
+		return &CommandError{Command: p.command(), ExitCode: -1, Err: err}
+	}
+
+	if err == nil || (p.Match != nil && p.Match.Match(stdout.Bytes())) {
+		return nil
+	}
+
+	cerr := &CommandError{
+		Command:  p.command(),
+		ExitCode: -1,
+		Stdout:   tail(stdout.String()),
+		Stderr:   tail(stderr.String()),
+		Err:      err,
+	}
+	var exitErr *exec.ExitError
+	if std_errors.As(err, &exitErr) {
+		cerr.ExitCode = exitErr.ExitCode()
+		cerr.Err = nil
+		if ctx.Err() != nil {
+			cerr.Err = ctx.Err()
+		}
+	}
+	return cerr
+}
+
+// run runs cmd in its own process group. Output is collected through pipes owned by probe,
+// so that cmd.Wait returns as soon as command exits and its background children can be killed
+// before waiting for output.
+func (p *CommandProbe) run(cmd *exec.Cmd) (stdout, stderr *bytes.Buffer, err error) {
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return nil, nil, err
+	}
+
+	cmd.Stdout = outW
+	cmd.Stderr = errW
+	setProcessGroup(cmd)
+
+	err = cmd.Start()
+	outW.Close()
+	errW.Close()
+	if err != nil {
+		outR.Close()
+		errR.Close()
+		return nil, nil, err
+	}
+
+	stdout = &bytes.Buffer{}
+	stderr = &bytes.Buffer{}
+	done := make(chan struct{}, 2)
+	go copyOutput(stdout, outR, done)
+	go copyOutput(stderr, errR, done)
+
+	err = waitProcess(cmd)
+
+	// processes that left the group may still hold pipes
+	t := time.AfterFunc(time.Second, func() {
+		outR.Close()
+		errR.Close()
+	})
+	<-done
+	<-done
+	t.Stop()
+	outR.Close()
+	errR.Close()
+
+	return stdout, stderr, err
+}
+
+func copyOutput(dst *bytes.Buffer, src *os.File, done chan<- struct{}) {
+	_, _ = io.Copy(dst, src)
+	done <- struct{}{}
+}
+
+// command returns command line for errors, with credentials redacted.
+func (p *CommandProbe) command() string {
+	cmd := []string{p.Path}
+	for _, a := range p.Args {
+		cmd = append(cmd, Redact(a))
+	}
+	return strings.Join(cmd, " ")
+}
+
+func tail(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > commandOutputTail {
+		return "..." + s[len(s)-commandOutputTail:]
+	}
+	return s
+}
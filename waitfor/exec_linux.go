@@ -0,0 +1,25 @@
+package waitfor
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const pPID = 1 // P_PID id type of waitid
+
+// waitExited blocks until process exits, leaving it waitable (not reaped).
+func waitExited(pid int) error {
+	// siginfo_t is 128 bytes
+	var info [128]byte
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPID, uintptr(pid),
+			uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|syscall.WNOWAIT, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
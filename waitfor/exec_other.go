@@ -0,0 +1,15 @@
+//go:build !unix
+
+package waitfor
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing, children of command are not cleaned up on these systems.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func waitProcess(cmd *exec.Cmd) error {
+	return cmd.Wait()
+}
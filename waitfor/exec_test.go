@@ -0,0 +1,144 @@
+package waitfor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandProbe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is required")
+	}
+
+	flag := filepath.Join(t.TempDir(), "ready")
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		_ = os.WriteFile(flag, []byte("PONG"), 0o600)
+	}()
+
+	err := WaitProbe(time.Second, time.Millisecond*50, &CommandProbe{
+		Path: "sh",
+		Args: []string{"-c", `test -f "$FLAG"`},
+		Env:  []string{"FLAG=" + flag},
+	})
+	if err != nil {
+		t.Fatal("Command not succeeded", err)
+	}
+
+	err = WaitProbe(time.Second, time.Millisecond*50, &CommandProbe{
+		Path:  "cat",
+		Args:  []string{flag},
+		Match: regexp.MustCompile(`^PONG`),
+	})
+	if err != nil {
+		t.Fatal("Command output not matched", err)
+	}
+
+	// exit code 0 or match
+	err = WaitProbe(time.Second, time.Millisecond*50, &CommandProbe{
+		Path:  "sh",
+		Args:  []string{"-c", "echo PONG; exit 1"},
+		Match: regexp.MustCompile(`^PONG`),
+	})
+	if err != nil {
+		t.Fatal("Matched output of failed command not accepted", err)
+	}
+	err = WaitProbe(time.Second, time.Millisecond*50, &CommandProbe{
+		Path:  "sh",
+		Args:  []string{"-c", "echo LOADING"},
+		Match: regexp.MustCompile(`^PONG`),
+	})
+	if err != nil {
+		t.Fatal("Successful command not accepted", err)
+	}
+
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*50, &CommandProbe{
+		Path:  "sh",
+		Args:  []string{"-c", "echo LOADING; echo no such database >&2; exit 3"},
+		Match: regexp.MustCompile(`^PONG`),
+	})
+	cerr, ok := err.(*CommandError)
+	if !ok || cerr.ExitCode != 3 || cerr.Stderr != "no such database" {
+		t.Fatal("Wrong command error", err)
+	}
+
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*50, &CommandProbe{
+		Path: "no-such-command-for-waitfor",
+	})
+	if err == nil || !strings.Contains(err.Error(), "no-such-command-for-waitfor") {
+		t.Fatal("Wrong command error", err)
+	}
+}
+
+func TestCommandProbeKillsGroup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc is required")
+	}
+
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	start := time.Now()
+	w := &Waiter{Timeout: time.Millisecond * 300, AttemptTimeout: time.Millisecond * 100, RetryAfter: time.Millisecond * 50}
+	err := w.WaitProbe(context.Background(), &CommandProbe{
+		Path: "sh",
+		Args: []string{"-c", "sleep 30 & echo $! > " + pidFile + "; wait"},
+	})
+	if err == nil {
+		t.Fatal("Hanging command succeeded")
+	}
+	if time.Since(start) > time.Second*2 {
+		t.Fatal("Probe waited for background process", time.Since(start))
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// killed process may remain zombie if nobody reaps it
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err == nil && !strings.Contains(string(stat), ") Z ") {
+		t.Fatal("Background process is still running", string(stat))
+	}
+}
+
+func TestCommandProbeKillsChildren(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc is required")
+	}
+
+	// command exits normally, leaving background child
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	err := WaitProbe(time.Second, time.Millisecond*50, &CommandProbe{
+		Path: "sh",
+		Args: []string{"-c", "sleep 30 > /dev/null 2>&1 & echo $! > " + pidFile},
+	})
+	if err != nil {
+		t.Fatal("Command not succeeded", err)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err == nil && !strings.Contains(string(stat), ") Z ") {
+		t.Fatal("Background process is still running", string(stat))
+	}
+}
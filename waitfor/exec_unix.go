@@ -0,0 +1,25 @@
+//go:build unix
+
+package waitfor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// waitProcess waits for command. Command could leave background children, so its process
+// group is killed when command exits, but before command is reaped: group id can not be
+// reused by another process while command is not reaped.
+func waitProcess(cmd *exec.Cmd) error {
+	if waitExited(cmd.Process.Pid) == nil {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd.Wait()
+}
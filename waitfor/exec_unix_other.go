@@ -0,0 +1,12 @@
+//go:build unix && !linux
+
+package waitfor
+
+import (
+	"github.com/hummerd/gostuff/errors"
+)
+
+// waitExited is not supported, process group is killed only when attempt is canceled.
+func waitExited(pid int) error {
+	return errors.New("Waiting without reaping is not supported")
+}
@@ -0,0 +1,147 @@
+package waitfor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// FileProbe checks that file or directory exists and optionally is not empty, has
+// expected checksum or has not changed for a quiet period. On Linux changes are watched
+// with inotify, so wait reacts to them without waiting for retry pause.
+type FileProbe struct {
+	// Path is path to file or directory (socket and other special files are treated as files).
+	Path string
+	// NonEmpty requires file to have non zero size or directory to have entries.
+	NonEmpty bool
+	// SHA256 if not empty is expected hex encoded checksum of file's content.
+	SHA256 string
+	// Quiet if not zero is period file (or directory's entries) must stay unchanged.
+	Quiet time.Duration
+
+	mu         sync.Mutex
+	state      string
+	lastChange time.Time
+}
+
+// Probe checks path.
+func (p *FileProbe) Probe(ctx context.Context) error {
+	fi, err := os.Stat(p.Path)
+	if err != nil {
+		return err
+	}
+
+	var (
+		state   string
+		modTime time.Time
+		empty   bool
+	)
+	if fi.IsDir() {
+		state, modTime, empty, err = dirState(p.Path)
+		if err != nil {
+			return err
+		}
+	} else {
+		state = fmt.Sprintf("%d %d %s", fi.Size(), fi.ModTime().UnixNano(), fi.Mode())
+		modTime = fi.ModTime()
+		empty = fi.Size() == 0
+	}
+
+	if p.NonEmpty && empty {
+		return errors.Newf("Path %s is empty", p.Path)
+	}
+
+	if p.SHA256 != "" {
+		if fi.IsDir() {
+			return errors.Newf("Can not check checksum of directory %s", p.Path)
+		}
+
+		sum, err := fileSHA256(p.Path)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, p.SHA256) {
+			return errors.Newf("File %s checksum is %s, expected %s", p.Path, sum, p.SHA256)
+		}
+	}
+
+	if p.Quiet > 0 {
+		changed := p.changedAt(state, modTime)
+		if since := time.Since(changed); since < p.Quiet {
+			return errors.Newf("Path %s changed %s ago, waiting for %s quiet period",
+				p.Path, since.Round(time.Millisecond), p.Quiet)
+		}
+	}
+
+	return nil
+}
+
+// Watch notifies about changes of path. Changes are coalesced, notifications come
+// no more often than once in 100ms.
+func (p *FileProbe) Watch(ctx context.Context) <-chan struct{} {
+	return watchPath(ctx, p.Path)
+}
+
+// changedAt returns time of last observed change. Modification time is used too, so that
+// path that was not changed long before wait started is ready right away.
+func (p *FileProbe) changedAt(state string, modTime time.Time) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if state != p.state {
+		if p.state != "" {
+			p.lastChange = time.Now()
+		}
+		p.state = state
+	}
+
+	if modTime.After(p.lastChange) {
+		return modTime
+	}
+	return p.lastChange
+}
+
+func dirState(path string) (state string, modTime time.Time, empty bool, err error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+
+	sb := strings.Builder{}
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			// entry removed while reading directory
+			continue
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+		fmt.Fprintf(&sb, "%s %d %d;", filepath.Base(e.Name()), fi.Size(), fi.ModTime().UnixNano())
+	}
+	return sb.String(), modTime, len(entries) == 0, nil
+}
+
+func fileSHA256(path string) (sum string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
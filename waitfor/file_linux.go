@@ -0,0 +1,72 @@
+package waitfor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_ATTRIB
+
+// watchMinPause is minimum pause between notifications, events that come during pause are
+// coalesced, so that constantly changing path does not make probe spin.
+const watchMinPause = 100 * time.Millisecond
+
+// watchPath watches path's parent directory (so creation and renames are noticed) and
+// path itself (so changes of directory's entries are noticed) with inotify.
+// Returns nil if inotify is not available.
+func watchPath(ctx context.Context, path string) <-chan struct{} {
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil
+	}
+
+	_, err = syscall.InotifyAddWatch(fd, filepath.Dir(path), inotifyMask)
+	if err != nil {
+		syscall.Close(fd)
+		return nil
+	}
+	// path may not exist yet, then its creation is noticed with parent's watch
+	_, _ = syscall.InotifyAddWatch(fd, path, inotifyMask)
+
+	// non blocking descriptor is handled by runtime poller, so Close interrupts Read
+	f := os.NewFile(uintptr(fd), "inotify")
+	changes := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, 4096)
+		var last time.Time
+		for {
+			_, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+
+			// events that come during pause stay in inotify queue and are read at once
+			if pause := watchMinPause - time.Since(last); pause > 0 {
+				t := time.NewTimer(pause)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return
+				case <-t.C:
+				}
+			}
+			last = time.Now()
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package waitfor
+
+import (
+	"context"
+)
+
+// watchPath returns nil, changes are detected by polling.
+func watchPath(ctx context.Context, path string) <-chan struct{} {
+	return nil
+}
@@ -0,0 +1,140 @@
+package waitfor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileProbe(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		_ = os.WriteFile(path, nil, 0o600)
+		time.Sleep(time.Millisecond * 100)
+		_ = os.WriteFile(path, []byte("key: value"), 0o600)
+	}()
+
+	err := WaitProbe(time.Second, time.Millisecond*50, &FileProbe{Path: path, NonEmpty: true})
+	if err != nil {
+		t.Fatal("File not ready", err)
+	}
+
+	sum := sha256.Sum256([]byte("key: value"))
+	err = WaitProbe(time.Second, time.Millisecond*50, &FileProbe{
+		Path:   path,
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		t.Fatal("File checksum not matched", err)
+	}
+
+	err = WaitProbe(time.Millisecond*200, time.Millisecond*50, &FileProbe{
+		Path:   path,
+		SHA256: strings.Repeat("0", 64),
+	})
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatal("Wrong checksum accepted", err)
+	}
+
+	err = WaitProbe(time.Millisecond*200, time.Millisecond*50, &FileProbe{Path: filepath.Join(dir, "none")})
+	if !os.IsNotExist(err) {
+		t.Fatal("Expected not exist error", err)
+	}
+}
+
+func TestFileProbeQuiet(t *testing.T) {
+	dir := t.TempDir()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond * 20):
+				_ = os.WriteFile(filepath.Join(dir, "part"), []byte(strings.Repeat("a", i)), 0o600)
+			}
+		}
+	}()
+
+	p := &FileProbe{Path: dir, NonEmpty: true, Quiet: time.Millisecond * 200}
+	err := WaitProbe(time.Millisecond*400, time.Millisecond*50, p)
+	if err == nil || !strings.Contains(err.Error(), "quiet period") {
+		t.Fatal("Changing directory is ready", err)
+	}
+
+	close(stop)
+	<-done
+
+	err = WaitProbe(time.Second, time.Millisecond*50, p)
+	if err != nil {
+		t.Fatal("Directory not ready", err)
+	}
+}
+
+func TestFileProbeWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is required")
+	}
+
+	path := filepath.Join(t.TempDir(), "ready")
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		_ = os.WriteFile(path, nil, 0o600)
+	}()
+
+	start := time.Now()
+	err := WaitProbe(time.Second*5, time.Second*3, &FileProbe{Path: path})
+	if err != nil {
+		t.Fatal("File not ready", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("File change was not noticed", time.Since(start))
+	}
+}
+
+func TestFileProbeWatchCoalesce(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is required")
+	}
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &FileProbe{Path: path}
+	changes := p.Watch(ctx)
+
+	// file is rewritten constantly
+	go func() {
+		for ctx.Err() == nil {
+			_ = os.WriteFile(path, []byte(time.Now().String()), 0o600)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	n := 0
+	timeout := time.After(time.Millisecond * 500)
+	for done := false; !done; {
+		select {
+		case <-changes:
+			n++
+		case <-timeout:
+			done = true
+		}
+	}
+	if n == 0 || n > 7 {
+		t.Fatal("Changes not coalesced", n)
+	}
+}
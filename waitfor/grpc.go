@@ -0,0 +1,258 @@
+package waitfor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// Health statuses of grpc.health.v1.Health service.
+const (
+	HealthUnknown HealthStatus = iota
+	HealthServing
+	HealthNotServing
+	HealthServiceUnknown
+)
+
+// gRPC status codes used by probe.
+const (
+	grpcOK               = 0
+	grpcNotFound         = 5
+	grpcPermissionDenied = 7
+	grpcUnimplemented    = 12
+	grpcUnauthenticated  = 16
+)
+
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+var regexGRPCScheme = regexp.MustCompile(`^grpcs?://`)
+
+// HealthStatus is serving status reported by gRPC health checking protocol.
+type HealthStatus int
+
+// String returns status name as defined by protocol.
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthServing:
+		return "SERVING"
+	case HealthNotServing:
+		return "NOT_SERVING"
+	case HealthServiceUnknown:
+		return "SERVICE_UNKNOWN"
+	}
+	return "UNKNOWN"
+}
+
+// GRPCHealthProbe checks service with standard gRPC health checking protocol
+// (grpc.health.v1.Health/Check). Service is available when it reports SERVING.
+type GRPCHealthProbe struct {
+	// Addr is server address in host:port form.
+	Addr string
+	// Service is name of checked service. Empty name means server's overall health.
+	Service string
+	// TLS enables TLS. Plain text HTTP/2 (h2c) is used otherwise, it requires Go 1.24.
+	TLS bool
+	// Config is used for TLS. If nil, empty config (system roots) is used.
+	Config *tls.Config
+	// Dialer is used to connect to server. If nil, direct connection is used.
+	Dialer Dialer
+}
+
+// HealthError describes failed health check.
+type HealthError struct {
+	Addr    string
+	Service string
+	Status  HealthStatus
+	// Code is gRPC status code of the call, zero if call succeeded.
+	Code int
+	// Message is gRPC status message of the call.
+	Message string
+}
+
+// Error returns error's text
+func (e *HealthError) Error() string {
+	if e.Code != grpcOK {
+		return fmt.Sprintf("gRPC service %q at %s is %s (grpc-status %d: %s)",
+			e.Service, e.Addr, e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("gRPC service %q at %s is %s", e.Service, e.Addr, e.Status)
+}
+
+// Probe calls health check and checks returned status.
+func (p *GRPCHealthProbe) Probe(ctx context.Context) error {
+	tr, err := p.transport()
+	if err != nil {
+		return err
+	}
+	defer tr.CloseIdleConnections()
+
+	scheme := "http"
+	if p.TLS {
+		scheme = "https"
+	}
+
+	body := grpcFrame(appendProtoString(nil, 1, p.Service))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		scheme+"://"+p.Addr+grpcHealthCheckPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Newf("gRPC health check of %s failed with HTTP status %s", p.Addr, resp.Status)
+	}
+
+	msg, err := readGRPCMessage(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Can not read gRPC health check response from %s: ", p.Addr)
+	}
+	// trailers are available only after body is read to the end
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	// trailers-only responses carry status in headers
+	code, text := resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	if code == "" {
+		code, text = resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	}
+	c, err := strconv.Atoi(code)
+	if err != nil {
+		return errors.Newf("gRPC health check of %s returned invalid grpc-status %q", p.Addr, code)
+	}
+	if c != grpcOK {
+		status := HealthUnknown
+		if c == grpcNotFound {
+			status = HealthServiceUnknown
+		}
+		text, _ = url.PathUnescape(text)
+		return &HealthError{Addr: p.Addr, Service: p.Service, Status: status, Code: c, Message: text}
+	}
+
+	status := HealthUnknown
+	err = readProtoFields(msg, func(field int, v uint64, _ []byte) {
+		if field == 1 {
+			status = HealthStatus(v)
+		}
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Can not parse gRPC health check response from %s: ", p.Addr)
+	}
+	if status != HealthServing {
+		return &HealthError{Addr: p.Addr, Service: p.Service, Status: status}
+	}
+	return nil
+}
+
+// grpcServiceProbe returns probe for grpc://host:port/service or grpcs://host:port/service
+// connection string.
+func grpcServiceProbe(s, host, port string) (*GRPCHealthProbe, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, errors.New("Can not parse service connection string: " + Redact(s))
+	}
+
+	return &GRPCHealthProbe{
+		Addr:    host + ":" + port,
+		Service: strings.TrimPrefix(u.Path, "/"),
+		TLS:     u.Scheme == "grpcs",
+	}, nil
+}
+
+// grpcFrame prefixes uncompressed message with gRPC length-prefixed framing.
+func grpcFrame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readGRPCMessage reads first gRPC message from r. Empty response gives nil message.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	h := make([]byte, 5)
+	_, err := io.ReadFull(r, h)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+
+	n := binary.BigEndian.Uint32(h[1:])
+	if n > 1<<16 {
+		return nil, errors.Newf("message is too large (%d bytes)", n)
+	}
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+	return msg, err
+}
+
+func appendProtoString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readProtoFields calls fn for every field of protobuf message. Varint fields are passed
+// in v, length-delimited fields in data, fixed size fields are skipped.
+func readProtoFields(b []byte, fn func(field int, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("invalid field tag")
+		}
+		b = b[n:]
+
+		field := int(tag >> 3)
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errors.Newf("invalid varint in field %d", field)
+			}
+			fn(field, v, nil)
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return errors.Newf("truncated field %d", field)
+			}
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errors.Newf("truncated field %d", field)
+			}
+			fn(field, 0, b[n:n+int(l)])
+			b = b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return errors.Newf("truncated field %d", field)
+			}
+			b = b[4:]
+		default:
+			return errors.Newf("unsupported wire type in field %d", field)
+		}
+	}
+	return nil
+}
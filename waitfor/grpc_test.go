@@ -0,0 +1,220 @@
+//go:build go1.24
+
+package waitfor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// healthServer is in-process implementation of grpc.health.v1.Health/Check.
+type healthServer struct {
+	mu       sync.Mutex
+	statuses map[string]HealthStatus
+	code     int
+}
+
+func (s *healthServer) SetStatus(service string, status HealthStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[service] = status
+}
+
+func (s *healthServer) SetCode(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.code = code
+}
+
+func (s *healthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.URL.Path != grpcHealthCheckPath ||
+		r.Header.Get("Content-Type") != "application/grpc" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	msg, err := readGRPCMessage(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	service := ""
+	_ = readProtoFields(msg, func(field int, _ uint64, data []byte) {
+		if field == 1 {
+			service = string(data)
+		}
+	})
+
+	s.mu.Lock()
+	status, ok := s.statuses[service]
+	code := s.code
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/grpc")
+	if !ok || code != grpcOK {
+		if code == grpcOK {
+			code = grpcNotFound
+		}
+		// trailers-only response
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+		w.Header().Set("Grpc-Message", "unknown%20service")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Trailer", "Grpc-Status")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(grpcFrame(appendProtoVarint(nil, 1, uint64(status))))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func startHealthServer(t *testing.T) (*healthServer, string) {
+	hs := &healthServer{statuses: map[string]HealthStatus{}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: hs, Protocols: &http.Protocols{}}
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(func() { srv.Close() })
+
+	return hs, l.Addr().String()
+}
+
+func TestGRPCHealthProbe(t *testing.T) {
+	hs, addr := startHealthServer(t)
+	hs.SetStatus("", HealthServing)
+	hs.SetStatus("orders", HealthNotServing)
+
+	p := &GRPCHealthProbe{Addr: addr}
+	err := p.Probe(context.Background())
+	if err != nil {
+		t.Fatal("Server not serving", err)
+	}
+
+	p.Service = "orders"
+	err = p.Probe(context.Background())
+	he, ok := err.(*HealthError)
+	if !ok || he.Status != HealthNotServing || !strings.Contains(err.Error(), "NOT_SERVING") {
+		t.Fatal("Expected NOT_SERVING", err)
+	}
+
+	p.Service = "users"
+	err = p.Probe(context.Background())
+	he, ok = err.(*HealthError)
+	if !ok || he.Status != HealthServiceUnknown || he.Message != "unknown service" {
+		t.Fatal("Expected SERVICE_UNKNOWN", err)
+	}
+	if ClassifyError(err) != Retryable {
+		t.Fatal("Unknown service is not retryable")
+	}
+
+	hs.SetCode(grpcUnimplemented)
+	err = p.Probe(context.Background())
+	if ClassifyError(err) != Permanent {
+		t.Fatal("Missing health service is not permanent", err)
+	}
+}
+
+func TestWaitGRPCService(t *testing.T) {
+	hs, addr := startHealthServer(t)
+	hs.SetStatus("orders", HealthNotServing)
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		hs.SetStatus("orders", HealthServing)
+	}()
+
+	err := WaitServices(time.Second, time.Millisecond*50, "grpc://"+addr+"/orders")
+	if err != nil {
+		t.Fatal("Service not serving", err)
+	}
+
+	err = WaitServices(time.Millisecond*200, time.Millisecond*50, "grpc://"+addr+"/users")
+	if err == nil || !strings.Contains(err.Error(), "SERVICE_UNKNOWN") {
+		t.Fatal("Expected SERVICE_UNKNOWN", err)
+	}
+}
+
+func TestGRPCHealthProbeTLS(t *testing.T) {
+	hs := &healthServer{statuses: map[string]HealthStatus{"": HealthServing}}
+	srv := httptest.NewUnstartedServer(hs)
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	p := &GRPCHealthProbe{
+		Addr:   srv.Listener.Addr().String(),
+		TLS:    true,
+		Config: &tls.Config{RootCAs: roots},
+	}
+	err := p.Probe(context.Background())
+	if err != nil {
+		t.Fatal("Server not serving", err)
+	}
+
+	p.Config = nil
+	err = p.Probe(context.Background())
+	if err == nil {
+		t.Fatal("Untrusted certificate accepted")
+	}
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func TestProtoFields(t *testing.T) {
+	b := appendProtoString(nil, 1, "svc")
+	b = appendProtoVarint(b, 2, 300)
+
+	var s string
+	var v uint64
+	err := readProtoFields(b, func(field int, val uint64, data []byte) {
+		switch field {
+		case 1:
+			s = string(data)
+		case 2:
+			v = val
+		}
+	})
+	if err != nil || s != "svc" || v != 300 {
+		t.Fatal("Wrong fields", s, v, err)
+	}
+
+	err = readProtoFields(b[:len(b)-1], func(int, uint64, []byte) {})
+	if err == nil {
+		t.Fatal("Truncated message parsed")
+	}
+
+	msg, err := readGRPCMessage(strings.NewReader(string(grpcFrame(b))))
+	if err != nil || string(msg) != string(b) {
+		t.Fatal("Wrong message", msg, err)
+	}
+	_, err = readGRPCMessage(io.LimitReader(strings.NewReader(string(grpcFrame(b))), 6))
+	if err == nil {
+		t.Fatal("Truncated frame read")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build go1.24
+
+package waitfor
+
+import (
+	"net/http"
+)
+
+// transport returns HTTP/2 transport, over TLS or plain text (h2c).
+func (p *GRPCHealthProbe) transport() (*http.Transport, error) {
+	tr := &http.Transport{
+		DialContext:     dialer(p.Dialer).DialContext,
+		TLSClientConfig: p.Config,
+		Protocols:       &http.Protocols{},
+	}
+	if p.TLS {
+		tr.Protocols.SetHTTP2(true)
+	} else {
+		tr.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return tr, nil
+}
@@ -0,0 +1,23 @@
+//go:build !go1.24
+
+package waitfor
+
+import (
+	std_errors "errors"
+	"net/http"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// transport returns HTTP/2 transport over TLS. Plain text HTTP/2 (h2c) is supported by
+// net/http since Go 1.24.
+func (p *GRPCHealthProbe) transport() (*http.Transport, error) {
+	if !p.TLS {
+		return nil, errors.Wrap(std_errors.ErrUnsupported, "gRPC health check over plain text requires Go 1.24: ")
+	}
+	return &http.Transport{
+		DialContext:       dialer(p.Dialer).DialContext,
+		TLSClientConfig:   p.Config,
+		ForceAttemptHTTP2: true,
+	}, nil
+}
@@ -0,0 +1,174 @@
+package waitfor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+const maxLineLength = 1 << 16
+
+var (
+	regexLineScheme = regexp.MustCompile(`^(memcached|nats|smtp)://`)
+
+	regexMemcachedVersion = regexp.MustCompile(`^VERSION `)
+	regexMemcachedError   = regexp.MustCompile(`^(CLIENT_|SERVER_)?ERROR`)
+	regexNATSInfo         = regexp.MustCompile(`^INFO \{`)
+	regexNATSPong         = regexp.MustCompile(`^PONG`)
+	regexNATSError        = regexp.MustCompile(`^-ERR`)
+	regexSMTPGreeting     = regexp.MustCompile(`^220 `) // last line of multiline greeting
+	regexSMTPHello        = regexp.MustCompile(`^250 `)
+	regexSMTPError        = regexp.MustCompile(`^[45]\d\d[ -]`)
+)
+
+// LineProbe checks service with line oriented protocol: it reads server's greeting, sends
+// command and waits for expected reply. Every expectation reads lines until one of them
+// matches, so multiline replies are matched by their last line.
+type LineProbe struct {
+	// Addr is service address in host:port form.
+	Addr string
+	// Greeting if not nil must match line sent by server right after connect.
+	Greeting *regexp.Regexp
+	// Send is sent to server after greeting, if not empty.
+	Send string
+	// Expect if not nil must match line sent by server in reply to Send.
+	Expect *regexp.Regexp
+	// Fail if not nil fails probe as soon as server sends matching line.
+	Fail *regexp.Regexp
+	// Quit is sent to server before connection is closed, if not empty.
+	Quit string
+	// Dialer is used to connect to service. If nil, direct connection is used.
+	Dialer Dialer
+}
+
+// Probe connects to service and checks its replies.
+func (p *LineProbe) Probe(ctx context.Context) (err error) {
+	conn, err := dialer(p.Dialer).DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := closeOnDone(ctx, conn)
+	defer func() { err = done(err) }()
+
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+
+	r := bufio.NewScanner(conn)
+	r.Buffer(make([]byte, 0, 512), maxLineLength)
+
+	if p.Greeting != nil {
+		err = p.expect(r, p.Greeting, "greeting")
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Send != "" {
+		_, err = conn.Write([]byte(p.Send))
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Expect != nil {
+		err = p.expect(r, p.Expect, "reply")
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Quit != "" {
+		_, _ = conn.Write([]byte(p.Quit))
+	}
+	return nil
+}
+
+func (p *LineProbe) expect(r *bufio.Scanner, re *regexp.Regexp, what string) error {
+	for r.Scan() {
+		line := r.Text()
+		if p.Fail != nil && p.Fail.MatchString(line) {
+			return errors.Newf("Service %s failed with %s %q", p.Addr, what, line)
+		}
+		if re.MatchString(line) {
+			return nil
+		}
+	}
+
+	err := r.Err()
+	if err == nil {
+		err = errors.Newf("Service %s closed connection while waiting for %s", p.Addr, what)
+	}
+	return err
+}
+
+// MemcachedProbe returns probe that sends version command to memcached.
+func MemcachedProbe(addr string) *LineProbe {
+	return &LineProbe{
+		Addr:   addr,
+		Send:   "version\r\n",
+		Expect: regexMemcachedVersion,
+		Fail:   regexMemcachedError,
+		Quit:   "quit\r\n",
+	}
+}
+
+// NATSProbe returns probe that reads NATS INFO banner, connects with specified credentials
+// (may be empty) and pings server.
+func NATSProbe(addr, user, password string) *LineProbe {
+	opts := struct {
+		Verbose  bool   `json:"verbose"`
+		User     string `json:"user,omitempty"`
+		Password string `json:"pass,omitempty"`
+	}{User: user, Password: password}
+	connect, _ := json.Marshal(opts)
+
+	return &LineProbe{
+		Addr:     addr,
+		Greeting: regexNATSInfo,
+		Send:     "CONNECT " + string(connect) + "\r\nPING\r\n",
+		Expect:   regexNATSPong,
+		Fail:     regexNATSError,
+	}
+}
+
+// SMTPProbe returns probe that reads SMTP 220 greeting and sends EHLO.
+func SMTPProbe(addr string) *LineProbe {
+	return &LineProbe{
+		Addr:     addr,
+		Greeting: regexSMTPGreeting,
+		Send:     "EHLO waitfor\r\n",
+		Expect:   regexSMTPHello,
+		Fail:     regexSMTPError,
+		Quit:     "QUIT\r\n",
+	}
+}
+
+// lineServiceProbe returns probe for memcached://, nats:// and smtp:// connection strings
+// or nil for other connection strings.
+func lineServiceProbe(s, host, port string) *LineProbe {
+	m := regexLineScheme.FindStringSubmatch(s)
+	if m == nil {
+		return nil
+	}
+
+	addr := host + ":" + port
+	switch m[1] {
+	case "memcached":
+		return MemcachedProbe(addr)
+	case "nats":
+		var user, password string
+		if u, err := url.Parse(s); err == nil && u.User != nil {
+			user = u.User.Username()
+			password, _ = u.User.Password()
+		}
+		return NATSProbe(addr, user, password)
+	}
+	return SMTPProbe(addr)
+}
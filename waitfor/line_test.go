@@ -0,0 +1,119 @@
+package waitfor
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/waitfor/waitfortest"
+)
+
+func TestLineProbes(t *testing.T) {
+	memcached := waitfortest.NewServer(waitfortest.Config{
+		Handler: waitfortest.ReplyHandler(map[string]string{"version": "VERSION 1.6.21\r\n"}),
+	})
+	defer memcached.Close()
+
+	nats := waitfortest.NewServer(waitfortest.Config{
+		Banner:  []byte(`INFO {"server_id":"test","auth_required":true}` + "\r\n"),
+		Handler: waitfortest.ReplyHandler(map[string]string{"PING": "PONG\r\n"}),
+	})
+	defer nats.Close()
+
+	smtp := waitfortest.NewServer(waitfortest.Config{
+		Banner:      []byte("220-mail.example.com ESMTP\r\n220 ready\r\n"),
+		BannerDelay: time.Millisecond * 50,
+		Handler: waitfortest.ReplyHandler(map[string]string{
+			"EHLO": "250-mail.example.com\r\n250-PIPELINING\r\n250 8BITMIME\r\n",
+			"QUIT": "221 bye\r\n",
+		}),
+	})
+	defer smtp.Close()
+
+	err := WaitServices(time.Second, time.Millisecond*50,
+		"memcached://"+memcached.Addr,
+		"nats://user:password@"+nats.Addr,
+		"smtp://"+smtp.Addr,
+	)
+	if err != nil {
+		t.Fatal("Services not available", err)
+	}
+
+	p := SMTPProbe(smtp.Addr)
+	p.Greeting = regexp.MustCompile(`^220 other`)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	err = p.Probe(ctx)
+	if err == nil {
+		t.Fatal("Wrong greeting accepted")
+	}
+}
+
+func TestLineProbeFail(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Banner: []byte(`INFO {"server_id":"test"}` + "\r\n"),
+		Handler: waitfortest.ReplyHandler(map[string]string{
+			"CONNECT": "-ERR 'Authorization Violation'\r\n",
+		}),
+	})
+	defer s.Close()
+
+	err := NATSProbe(s.Addr, "", "").Probe(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Fatal("Expected authorization error", err)
+	}
+
+	s.SetMode(waitfortest.Drop)
+	err = NATSProbe(s.Addr, "", "").Probe(context.Background())
+	if err == nil {
+		t.Fatal("Dropped connection accepted")
+	}
+}
+
+func TestLineProbeSendExpect(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Handler: waitfortest.ReplyHandler(map[string]string{"STATUS": "STATUS starting\r\n"}),
+	})
+	defer s.Close()
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		s.SetMode(waitfortest.Down)
+		s.Close()
+	}()
+
+	p := &LineProbe{
+		Addr:   s.Addr,
+		Send:   "STATUS\r\n",
+		Expect: regexp.MustCompile(`^STATUS ready`),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := p.Probe(ctx)
+	if err == nil {
+		t.Fatal("Wrong reply accepted")
+	}
+}
+
+func TestLineProbeCancel(t *testing.T) {
+	srv := waitfortest.NewServer(waitfortest.Config{
+		Schedule: []waitfortest.Step{{Mode: waitfortest.HalfOpen}},
+	})
+	defer srv.Close()
+
+	// ctx without deadline, canceled while server never sends greeting
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+
+	p := SMTPProbe(srv.Addr)
+	start := time.Now()
+	err := p.Probe(ctx)
+	if err != context.Canceled || time.Since(start) > time.Second {
+		t.Fatal("Probe not canceled", err, time.Since(start))
+	}
+}
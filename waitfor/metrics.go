@@ -0,0 +1,183 @@
+package waitfor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	attemptsBuckets    = []float64{1, 2, 3, 5, 10, 20, 50, 100}
+	timeToReadyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+)
+
+// histogram is cumulative histogram in Prometheus sense.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) clone() *histogram {
+	c := *h
+	c.counts = append([]uint64(nil), h.counts...)
+	return &c
+}
+
+// waitMetrics are metrics of single service.
+type waitMetrics struct {
+	attempts    *histogram
+	timeToReady *histogram
+	ready       uint64
+	failed      uint64
+}
+
+// recordWait records finished wait for service name.
+func (r *Registry) recordWait(name string, attempts int, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.waits[name]
+	if !ok {
+		m = &waitMetrics{
+			attempts:    newHistogram(attemptsBuckets),
+			timeToReady: newHistogram(timeToReadyBuckets),
+		}
+		r.waits[name] = m
+	}
+
+	m.attempts.observe(float64(attempts))
+	if err != nil {
+		m.failed++
+		return
+	}
+	m.ready++
+	m.timeToReady.observe(elapsed.Seconds())
+}
+
+// WriteMetrics writes metrics of r in Prometheus text exposition format:
+//
+//	waitfor_up                    gauge, 1 if last check of service succeeded
+//	waitfor_waits_total           counter of finished waits by result (ready or failed)
+//	waitfor_wait_attempts         histogram of attempts per wait
+//	waitfor_time_to_ready_seconds histogram of time to ready of successful waits
+func (r *Registry) WriteMetrics(w io.Writer) error {
+	// metrics are copied, so slow writer does not block waiters recording their checks
+	ups, waits := r.copyMetrics()
+
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw, "waitfor_up", "gauge", "Whether last check of service succeeded.")
+	for _, u := range ups {
+		up := 0
+		if u.up {
+			up = 1
+		}
+		fmt.Fprintf(bw, "waitfor_up{service=%s} %d\n", quoteLabel(u.name), up)
+	}
+
+	writeHeader(bw, "waitfor_waits_total", "counter", "Finished waits by result.")
+	for _, m := range waits {
+		fmt.Fprintf(bw, "waitfor_waits_total{service=%s,result=\"ready\"} %d\n", quoteLabel(m.name), m.ready)
+		fmt.Fprintf(bw, "waitfor_waits_total{service=%s,result=\"failed\"} %d\n", quoteLabel(m.name), m.failed)
+	}
+
+	writeHeader(bw, "waitfor_wait_attempts", "histogram", "Attempts made by wait.")
+	for _, m := range waits {
+		writeHistogram(bw, "waitfor_wait_attempts", m.name, m.attempts)
+	}
+
+	writeHeader(bw, "waitfor_time_to_ready_seconds", "histogram", "Time until service became ready.")
+	for _, m := range waits {
+		writeHistogram(bw, "waitfor_time_to_ready_seconds", m.name, m.timeToReady)
+	}
+
+	return bw.Flush()
+}
+
+type upMetric struct {
+	name string
+	up   bool
+}
+
+type namedWaitMetrics struct {
+	name string
+	waitMetrics
+}
+
+// copyMetrics returns copy of r's metrics sorted by service name.
+func (r *Registry) copyMetrics() ([]upMetric, []namedWaitMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ups := make([]upMetric, 0, len(r.endpoints))
+	for name, e := range r.endpoints {
+		ups = append(ups, upMetric{name: name, up: e.State == StateUp})
+	}
+	sort.Slice(ups, func(i, j int) bool { return ups[i].name < ups[j].name })
+
+	waits := make([]namedWaitMetrics, 0, len(r.waits))
+	for name, m := range r.waits {
+		waits = append(waits, namedWaitMetrics{name: name, waitMetrics: waitMetrics{
+			attempts:    m.attempts.clone(),
+			timeToReady: m.timeToReady.clone(),
+			ready:       m.ready,
+			failed:      m.failed,
+		}})
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i].name < waits[j].name })
+	return ups, waits
+}
+
+// MetricsHandler returns http.Handler that serves metrics of r in Prometheus text
+// exposition format.
+func MetricsHandler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteMetrics(w)
+	})
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(w io.Writer, metric, service string, h *histogram) {
+	label := quoteLabel(service)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{service=%s,le=\"%s\"} %d\n", metric, label, formatFloat(b), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{service=%s,le=\"+Inf\"} %d\n", metric, label, h.count)
+	fmt.Fprintf(w, "%s_sum{service=%s} %s\n", metric, label, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count{service=%s} %d\n", metric, label, h.count)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
@@ -0,0 +1,110 @@
+package waitfor
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+func TestMetrics(t *testing.T) {
+	w := &Waiter{Timeout: time.Second, RetryAfter: time.Millisecond * 10, Registry: NewRegistry()}
+
+	_, err := w.Wait(context.Background(), Service{Name: "db", Probe: availableAfter(time.Millisecond * 50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Wait(context.Background(), Service{
+		Name:    `bad "name"`,
+		Probe:   ProbeFunc(func(ctx context.Context) error { return errors.New("down") }),
+		Timeout: time.Millisecond * 30,
+	})
+
+	srv := httptest.NewServer(MetricsHandler(w.Registry))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+
+	expected := []string{
+		"# TYPE waitfor_up gauge",
+		`waitfor_up{service="db"} 1`,
+		`waitfor_up{service="bad \"name\""} 0`,
+		`waitfor_waits_total{service="db",result="ready"} 1`,
+		`waitfor_waits_total{service="bad \"name\"",result="failed"} 1`,
+		"# TYPE waitfor_wait_attempts histogram",
+		`waitfor_wait_attempts_bucket{service="db",le="1"} 0`,
+		`waitfor_wait_attempts_bucket{service="db",le="+Inf"} 1`,
+		`waitfor_wait_attempts_count{service="db"} 1`,
+		`waitfor_time_to_ready_seconds_bucket{service="db",le="0.025"} 0`,
+		`waitfor_time_to_ready_seconds_bucket{service="db",le="0.1"} 1`,
+		`waitfor_time_to_ready_seconds_count{service="bad \"name\""} 0`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(text, e+"\n") {
+			t.Fatal("Metric not found", e, "\n", text)
+		}
+	}
+}
+
+// blockingWriter blocks every write until unblock is closed.
+type blockingWriter struct {
+	writing chan struct{}
+	unblock chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case w.writing <- struct{}{}:
+	default:
+	}
+	<-w.unblock
+	return len(p), nil
+}
+
+func TestWriteMetricsSlowWriter(t *testing.T) {
+	r := NewRegistry()
+	r.Record("db", nil, time.Millisecond)
+
+	w := &blockingWriter{writing: make(chan struct{}, 1), unblock: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- r.WriteMetrics(w)
+	}()
+	<-w.writing
+
+	recorded := make(chan struct{})
+	go func() {
+		r.Record("db", errors.New("down"), time.Millisecond)
+		close(recorded)
+	}()
+
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Fatal("Record blocked by slow metrics writer")
+	}
+	close(w.unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 5})
+	h.observe(0.5)
+	h.observe(3)
+	h.observe(10)
+	if h.counts[0] != 1 || h.counts[1] != 2 || h.count != 3 || h.sum != 13.5 {
+		t.Fatal("Wrong histogram", h)
+	}
+}
@@ -0,0 +1,105 @@
+package waitfor
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+const portFreeRetryAfter = time.Millisecond * 50
+
+// WaitPortFree waits while tcp address addr (host:port) can be bound, e.g. after previous
+// server using it is shut down. Wait is limited only by ctx.
+func WaitPortFree(ctx context.Context, addr string) error {
+	w := &Waiter{RetryAfter: portFreeRetryAfter}
+	return w.WaitPortFree(ctx, addr)
+}
+
+// WaitPortFree waits while tcp address addr (host:port) can be bound.
+func (w *Waiter) WaitPortFree(ctx context.Context, addr string) error {
+	err := w.WaitProbe(ctx, &PortFreeProbe{Addr: addr})
+	if err != nil {
+		return errors.Wrapf(err, "Port %s not free: ", addr)
+	}
+	return nil
+}
+
+// PortFreeProbe checks that tcp address can be bound.
+type PortFreeProbe struct {
+	// Addr is address in host:port form.
+	Addr string
+}
+
+// Probe checks that Addr can be bound by listening on it.
+func (p *PortFreeProbe) Probe(ctx context.Context) error {
+	var lc net.ListenConfig
+	l, err := lc.Listen(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	return l.Close()
+}
+
+// ReservedPort is free tcp port held by listener until it is handed over.
+type ReservedPort struct {
+	// Addr is reserved address in host:port form.
+	Addr string
+
+	mu sync.Mutex
+	l  net.Listener
+}
+
+// ReservePorts reserves n distinct free tcp ports on loopback interface. Ports are held by
+// listeners, so they can not be taken by anybody else until handed over with Listener or
+// Release.
+func ReservePorts(n int) ([]*ReservedPort, error) {
+	ports := make([]*ReservedPort, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			for _, p := range ports {
+				_ = p.Release()
+			}
+			return nil, errors.Wrap(err, "Can not reserve port: ")
+		}
+		ports = append(ports, &ReservedPort{Addr: l.Addr().String(), l: l})
+	}
+	return ports, nil
+}
+
+// Host returns reserved port's host.
+func (p *ReservedPort) Host() string {
+	h, _, _ := net.SplitHostPort(p.Addr)
+	return h
+}
+
+// Port returns reserved port's number.
+func (p *ReservedPort) Port() string {
+	_, port, _ := net.SplitHostPort(p.Addr)
+	return port
+}
+
+// Listener hands reserved listener over to caller, caller is responsible for closing it.
+// This is race free way to use reserved port in the same process. Returns nil if port is
+// already handed over or released.
+func (p *ReservedPort) Listener() net.Listener {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l := p.l
+	p.l = nil
+	return l
+}
+
+// Release closes reserved listener, so port can be bound by another process. Use
+// WaitPortFree if it has to be sure that port is free.
+func (p *ReservedPort) Release() error {
+	l := p.Listener()
+	if l == nil {
+		return nil
+	}
+	return l.Close()
+}
@@ -0,0 +1,86 @@
+package waitfor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReservePorts(t *testing.T) {
+	ports, err := ReservePorts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, p := range ports {
+		if seen[p.Addr] {
+			t.Fatal("Port reserved twice", p.Addr)
+		}
+		seen[p.Addr] = true
+
+		_, err := net.Listen("tcp", p.Addr)
+		if err == nil {
+			t.Fatal("Reserved port can be bound", p.Addr)
+		}
+	}
+
+	l := ports[0].Listener()
+	if l == nil || l.Addr().String() != ports[0].Addr {
+		t.Fatal("Wrong listener", l)
+	}
+	defer l.Close()
+	if ports[0].Listener() != nil || ports[0].Release() != nil {
+		t.Fatal("Listener handed over twice")
+	}
+
+	err = WaitTCPPort(time.Second, time.Millisecond*50, ports[0].Host(), ports[0].Port())
+	if err != nil {
+		t.Fatal("Handed over port not available", err)
+	}
+
+	for _, p := range ports[1:] {
+		err = p.Release()
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := net.Listen("tcp", p.Addr)
+		if err != nil {
+			t.Fatal("Released port can not be bound", err)
+		}
+		l.Close()
+	}
+}
+
+func TestWaitPortFree(t *testing.T) {
+	ports, err := ReservePorts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		ports[0].Release()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = WaitPortFree(ctx, ports[0].Addr)
+	if err != nil {
+		t.Fatal("Port not free", err)
+	}
+
+	l, err := net.Listen("tcp", ports[0].Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	err = WaitPortFree(ctx, ports[0].Addr)
+	if err == nil {
+		t.Fatal("Busy port is free")
+	}
+}
@@ -0,0 +1,50 @@
+package waitfor
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redacted = "xxxxx"
+
+var (
+	regexURLScheme   = regexp.MustCompile(`^[a-zA-Z][\w+.-]*://`)
+	regexDsnPassword = regexp.MustCompile(`^([^:@/()]*):(.*)@(\w*\()`)    // user:password@tcp(
+	regexUserInfo    = regexp.MustCompile(`^([^:@/()\s=;]*):([^\s?#]*)@`) // user:password@host:port
+	regexKVPassword  = regexp.MustCompile(`(?i)\b(password|passwd|pwd|pass|secret|token|sslpassword|api[_-]?key)` +
+		`(\s*=\s*)('(?:[^'\\]|\\.)*'|"[^"]*"|[^\s;&]*)`) // password=secret, also in url query
+)
+
+// Redact returns connection string with passwords, secrets and tokens replaced by xxxxx.
+// All connection string forms supported by WaitServices are understood, as well as
+// password-like parameters in url queries and key=value strings.
+func Redact(dsn string) string {
+	if loc := regexURLScheme.FindStringIndex(dsn); loc != nil {
+		dsn = dsn[:loc[1]] + redactUserInfo(dsn[loc[1]:])
+	} else if m := regexDsnPassword.FindStringSubmatchIndex(dsn); m != nil {
+		dsn = dsn[:m[3]] + ":" + redacted + "@" + dsn[m[6]:]
+	} else if m := regexUserInfo.FindStringSubmatchIndex(dsn); m != nil {
+		dsn = dsn[:m[3]] + ":" + redacted + dsn[m[5]:]
+	}
+
+	return regexKVPassword.ReplaceAllString(dsn, "${1}${2}"+redacted)
+}
+
+// redactUserInfo redacts password in user:password@host/path. Last @ before query is treated
+// as end of user info, so passwords with unescaped @ are redacted completely.
+func redactUserInfo(s string) string {
+	end := strings.IndexAny(s, "?#")
+	if end < 0 {
+		end = len(s)
+	}
+	at := strings.LastIndex(s[:end], "@")
+	if at < 0 {
+		return s
+	}
+
+	colon := strings.Index(s[:at], ":")
+	if colon < 0 {
+		return s
+	}
+	return s[:colon+1] + redacted + s[at:]
+}
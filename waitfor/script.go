@@ -0,0 +1,217 @@
+package waitfor
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+const maxScriptBuffer = 1 << 16
+
+// ScriptStep is single step of ScriptProbe. Send is sent first, then reply is checked
+// with Expect or ExpectPrefix.
+type ScriptStep struct {
+	// Send is sent to server, if not empty.
+	Send []byte
+	// Expect if not nil must match data received from server. Data up to the end of
+	// match is consumed, the rest is left for next steps.
+	Expect *regexp.Regexp
+	// ExpectPrefix if not empty must be exact prefix of data received from server.
+	// Prefix is consumed, the rest is left for next steps.
+	ExpectPrefix []byte
+	// Timeout limits step. Zero means step is limited only by probe's context.
+	Timeout time.Duration
+}
+
+// ScriptProbe checks service with script of send/expect steps run over single tcp
+// connection. It checks services with protocols that have no built-in probe.
+type ScriptProbe struct {
+	// Addr is service address in host:port form.
+	Addr string
+	// Steps are run in order, probe succeeds when all steps succeed.
+	Steps []ScriptStep
+	// Dialer is used to connect to service. If nil, direct connection is used.
+	Dialer Dialer
+}
+
+// Probe connects to service and runs script.
+func (p *ScriptProbe) Probe(ctx context.Context) (err error) {
+	conn, err := dialer(p.Dialer).DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := closeOnDone(ctx, conn)
+	defer func() { err = done(err) }()
+
+	var buf []byte
+	for i, st := range p.Steps {
+		deadline, ok := ctx.Deadline()
+		if st.Timeout > 0 {
+			if sd := time.Now().Add(st.Timeout); !ok || sd.Before(deadline) {
+				deadline, ok = sd, true
+			}
+		}
+		if !ok {
+			deadline = time.Time{} // drop deadline of previous step
+		}
+		_ = conn.SetDeadline(deadline)
+
+		buf, err = runScriptStep(conn, st, buf)
+		if err != nil {
+			return errors.Wrapf(err, "Step %d of script for %s failed: ", i+1, p.Addr)
+		}
+	}
+	return nil
+}
+
+// runScriptStep runs step over conn, buf is data received but not consumed by previous
+// steps. Returns data not consumed by step.
+func runScriptStep(conn net.Conn, st ScriptStep, buf []byte) ([]byte, error) {
+	if len(st.Send) > 0 {
+		_, err := conn.Write(st.Send)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	match := func() (int, bool) {
+		if st.Expect != nil {
+			loc := st.Expect.FindIndex(buf)
+			if loc == nil {
+				return 0, false
+			}
+			return loc[1], true
+		}
+		if len(buf) < len(st.ExpectPrefix) {
+			return 0, false
+		}
+		return len(st.ExpectPrefix), true
+	}
+
+	if st.Expect == nil && len(st.ExpectPrefix) == 0 {
+		return buf, nil
+	}
+
+	chunk := make([]byte, 4096)
+	for {
+		if end, ok := match(); ok {
+			if st.Expect == nil && !bytes.Equal(buf[:end], st.ExpectPrefix) {
+				return nil, errors.Newf("expected %q, received %q", st.ExpectPrefix, buf[:end])
+			}
+			return buf[end:], nil
+		}
+
+		if len(buf) >= maxScriptBuffer {
+			return nil, errors.Newf("expected reply not found in %d received bytes", len(buf))
+		}
+
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if err != nil {
+			if _, ok := match(); ok {
+				continue
+			}
+			return nil, errors.Wrapf(err, "expected reply not received (received %q): ", tail(string(buf)))
+		}
+	}
+}
+
+// scriptManifest is json form of ScriptProbe.
+type scriptManifest struct {
+	Addr  string `json:"addr"`
+	Steps []struct {
+		Send            string `json:"send"`
+		SendHex         string `json:"send_hex"`
+		Expect          string `json:"expect"`
+		ExpectPrefix    string `json:"expect_prefix"`
+		ExpectPrefixHex string `json:"expect_prefix_hex"`
+		Timeout         string `json:"timeout"`
+	} `json:"steps"`
+}
+
+// ParseScript parses ScriptProbe from json manifest:
+//
+//	{
+//	  "addr": "host:port",
+//	  "steps": [
+//	    {"send": "HELLO\r\n", "expect": "^WELCOME", "timeout": "2s"},
+//	    {"send_hex": "0a0b0c", "expect_prefix_hex": "0d0e"},
+//	    {"send": "STATUS\r\n", "expect_prefix": "OK"}
+//	  ]
+//	}
+//
+// Every step has at most one of send and send_hex and at most one of expect (regular
+// expression), expect_prefix and expect_prefix_hex. Timeout is in time.ParseDuration format.
+func ParseScript(data []byte) (*ScriptProbe, error) {
+	var m scriptManifest
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can not parse script: ")
+	}
+
+	p := &ScriptProbe{Addr: m.Addr}
+	for i, ms := range m.Steps {
+		if ms.Send != "" && ms.SendHex != "" {
+			return nil, errors.Newf("Step %d of script has both send and send_hex", i+1)
+		}
+		if countNonEmpty(ms.Expect, ms.ExpectPrefix, ms.ExpectPrefixHex) > 1 {
+			return nil, errors.Newf("Step %d of script has more than one expectation", i+1)
+		}
+
+		st := ScriptStep{Send: []byte(ms.Send), ExpectPrefix: []byte(ms.ExpectPrefix)}
+		if ms.SendHex != "" {
+			st.Send, err = hex.DecodeString(ms.SendHex)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Wrong send_hex in step %d of script: ", i+1)
+			}
+		}
+		if ms.ExpectPrefixHex != "" {
+			st.ExpectPrefix, err = hex.DecodeString(ms.ExpectPrefixHex)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Wrong expect_prefix_hex in step %d of script: ", i+1)
+			}
+		}
+		if ms.Expect != "" {
+			st.Expect, err = regexp.Compile(ms.Expect)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Wrong expect in step %d of script: ", i+1)
+			}
+		}
+		if ms.Timeout != "" {
+			st.Timeout, err = time.ParseDuration(ms.Timeout)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Wrong timeout in step %d of script: ", i+1)
+			}
+		}
+		p.Steps = append(p.Steps, st)
+	}
+	return p, nil
+}
+
+// LoadScript reads ScriptProbe from json manifest file, see ParseScript for format.
+func LoadScript(path string) (*ScriptProbe, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScript(data)
+}
+
+func countNonEmpty(ss ...string) int {
+	n := 0
+	for _, s := range ss {
+		if s != "" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,163 @@
+package waitfor
+
+import (
+	"context"
+	std_errors "errors"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/waitfor/waitfortest"
+)
+
+func TestScriptProbe(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Banner: []byte{0xca, 0xfe, 0x01, 'r', 'e', 'a', 'd', 'y'},
+		Handler: waitfortest.ReplyHandler(map[string]string{
+			"STATUS": "STATUS ok\r\nload 0.1\r\n",
+			"HANG":   "",
+		}),
+	})
+	defer s.Close()
+
+	p := &ScriptProbe{
+		Addr: s.Addr,
+		Steps: []ScriptStep{
+			{ExpectPrefix: []byte{0xca, 0xfe}},
+			{Expect: regexp.MustCompile(`^\x01ready`)},
+			{Send: []byte("STATUS\r\n"), Expect: regexp.MustCompile(`STATUS (ok|degraded)\r\n`)},
+			{ExpectPrefix: []byte("load")},
+		},
+	}
+	err := p.Probe(context.Background())
+	if err != nil {
+		t.Fatal("Script failed", err)
+	}
+
+	p.Steps = []ScriptStep{
+		{ExpectPrefix: []byte{0xca, 0xff}},
+	}
+	err = p.Probe(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Step 1") {
+		t.Fatal("Wrong prefix accepted", err)
+	}
+
+	p.Steps = []ScriptStep{
+		{ExpectPrefix: []byte{0xca, 0xfe}},
+		{Send: []byte("HANG\r\n"), Expect: regexp.MustCompile(`never`), Timeout: time.Millisecond * 100},
+	}
+	start := time.Now()
+	err = p.Probe(context.Background())
+	var ne net.Error
+	if err == nil || !strings.Contains(err.Error(), "Step 2") || time.Since(start) > time.Second {
+		t.Fatal("Step timeout not applied", err, time.Since(start))
+	}
+	if !std_errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatal("Expected timeout error", err)
+	}
+}
+
+func TestScriptProbeStepDeadline(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("HELLO\r\n"))
+		time.Sleep(time.Millisecond * 300)
+		_, _ = conn.Write([]byte("READY\r\n"))
+	}()
+
+	// second step has no timeout and must not inherit deadline of the first one
+	p := &ScriptProbe{
+		Addr: l.Addr().String(),
+		Steps: []ScriptStep{
+			{ExpectPrefix: []byte("HELLO"), Timeout: time.Millisecond * 100},
+			{Expect: regexp.MustCompile(`READY`)},
+		},
+	}
+	err = p.Probe(context.Background())
+	if err != nil {
+		t.Fatal("Step without timeout failed", err)
+	}
+}
+
+func TestScriptProbeCancel(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Schedule: []waitfortest.Step{{Mode: waitfortest.HalfOpen}},
+	})
+	defer s.Close()
+
+	// ctx without deadline, canceled while server never answers
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+
+	p := &ScriptProbe{
+		Addr:  s.Addr,
+		Steps: []ScriptStep{{Expect: regexp.MustCompile(`READY`)}},
+	}
+	start := time.Now()
+	err := p.Probe(ctx)
+	if err != context.Canceled || time.Since(start) > time.Second {
+		t.Fatal("Probe not canceled", err, time.Since(start))
+	}
+}
+
+func TestLoadScript(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Handler: waitfortest.ReplyHandler(map[string]string{"\x00\x01PING": "\x00\x02PONG\n"}),
+	})
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "script.json")
+	err := os.WriteFile(path, []byte(`{
+		"addr": "`+s.Addr+`",
+		"steps": [
+			{"send_hex": "000150494e470a", "expect_prefix_hex": "0002", "timeout": "1s"},
+			{"expect": "^PONG"}
+		]
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Steps) != 2 || p.Steps[0].Timeout != time.Second {
+		t.Fatal("Wrong script", p)
+	}
+
+	err = WaitProbe(time.Second, time.Millisecond*50, p)
+	if err != nil {
+		t.Fatal("Script failed", err)
+	}
+
+	_, err = ParseScript([]byte(`{"steps": [{"expect": "a", "expect_prefix": "b"}]}`))
+	if err == nil {
+		t.Fatal("Step with two expectations accepted")
+	}
+	_, err = ParseScript([]byte(`{"steps": [{"send_hex": "zz"}]}`))
+	if err == nil {
+		t.Fatal("Wrong hex accepted")
+	}
+	_, err = ParseScript([]byte(`{"steps": [{"expect": "("}]}`))
+	if err == nil {
+		t.Fatal("Wrong regexp accepted")
+	}
+}
@@ -0,0 +1,197 @@
+package waitfor
+
+import (
+	"context"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// MinShare is minimum limit of service without own Timeout, even if Timeouts of other
+// services take whole budget.
+const MinShare = 100 * time.Millisecond
+
+// DefaultOptionalTimeout limits optional service without own Timeout if there is no budget.
+const DefaultOptionalTimeout = 10 * time.Second
+
+// Service is service waited by Waiter.Wait.
+type Service struct {
+	// Name is used in errors and reports. If empty, redacted Target or probe's description
+	// is used.
+	Name string
+	// Target is connection string in one of forms supported by WaitServices.
+	// Ignored if Probe is set.
+	Target string
+	// Probe checks service.
+	Probe Probe
+	// Weight is service's relative share of overall budget. Zero means 1.
+	Weight int
+	// Timeout is service's own limit. Service with Timeout does not take share of
+	// overall budget, it is limited by Timeout only.
+	Timeout time.Duration
+	// Optional service does not fail wait. It is waited only for its Timeout or its share
+	// of budget (DefaultOptionalTimeout without budget) and reported as degraded if it is
+	// not available.
+	Optional bool
+}
+
+// Report describes results of Waiter.Wait.
+type Report struct {
+	// Services has result for every service waited, in order.
+	Services []ServiceResult
+}
+
+// ServiceResult is result of waiting for single service.
+type ServiceResult struct {
+	// Name is service's name.
+	Name string
+	// Optional is true for optional services.
+	Optional bool
+	// Err is nil if service is available.
+	Err error
+	// Elapsed is time spent waiting for service.
+	Elapsed time.Duration
+}
+
+// Degraded returns names of optional services that are not available, features
+// depending on them should be turned off.
+func (r *Report) Degraded() []string {
+	var names []string
+	for _, s := range r.Services {
+		if s.Optional && s.Err != nil {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// IsDegraded reports whether optional service with specified name is not available.
+func (r *Report) IsDegraded(name string) bool {
+	for _, s := range r.Services {
+		if s.Name == name {
+			return s.Optional && s.Err != nil
+		}
+	}
+	return false
+}
+
+func (s *Service) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	if s.Probe != nil {
+		return probeName(s.Probe)
+	}
+	return Redact(s.Target)
+}
+
+func (s *Service) weight() int {
+	if s.Weight > 0 {
+		return s.Weight
+	}
+	return 1
+}
+
+// Wait waits for services one by one within overall budget. Budget is Waiter's Timeout or
+// ctx's deadline. Every service is guaranteed its share of budget: its own Timeout if set,
+// otherwise part of budget left after Timeouts proportional to its Weight. Required service
+// can use more than its share if previous services took less than theirs, but it never eats
+// shares of services that come after it. Optional services never take more than their share.
+// Share is never less than MinShare, so if Timeouts take whole budget services without Timeout
+// are still checked (overall budget is not extended though). Without budget services are limited
+// only by their own Timeouts, optional services without Timeout are limited by
+// DefaultOptionalTimeout.
+//
+// Wait fails on first unavailable required service, unavailable optional services are
+// reported as degraded. Report is returned in both cases.
+func (w *Waiter) Wait(ctx context.Context, services ...Service) (*Report, error) {
+	ctx, cancel := w.context(ctx)
+	defer cancel()
+
+	deadline, hasBudget := ctx.Deadline()
+	shares := budgetShares(time.Until(deadline), services)
+	report := &Report{}
+
+	for i := range services {
+		s := &services[i]
+
+		limit := s.Timeout
+		switch {
+		case limit > 0:
+		case hasBudget:
+			limit = shares[i]
+			if !s.Optional {
+				later := time.Duration(0)
+				for _, sh := range shares[i+1:] {
+					later += sh
+				}
+				if left := time.Until(deadline) - later; left > limit {
+					limit = left
+				}
+			}
+			if limit < MinShare {
+				limit = MinShare
+			}
+		case s.Optional:
+			limit = DefaultOptionalTimeout
+		}
+
+		start := time.Now()
+		err := w.waitServiceLimited(ctx, s, limit)
+		report.Services = append(report.Services, ServiceResult{
+			Name:     s.name(),
+			Optional: s.Optional,
+			Err:      err,
+			Elapsed:  time.Since(start),
+		})
+		if err != nil && !s.Optional {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func (w *Waiter) waitServiceLimited(ctx context.Context, s *Service, limit time.Duration) error {
+	if limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+
+	if s.Probe == nil {
+		return w.waitService(ctx, s.Target, s.name())
+	}
+
+	err := w.waitProbe(ctx, s.name(), s.Probe)
+	if err != nil {
+		return errors.Wrapf(err, "Service %s not available: ", s.name())
+	}
+	return nil
+}
+
+// budgetShares returns guaranteed share of budget for every service.
+func budgetShares(budget time.Duration, services []Service) []time.Duration {
+	shares := make([]time.Duration, len(services))
+
+	weights := 0
+	for i, s := range services {
+		if s.Timeout > 0 {
+			shares[i] = s.Timeout
+			budget -= s.Timeout
+			continue
+		}
+		weights += s.weight()
+	}
+
+	if budget <= 0 || weights == 0 {
+		return shares
+	}
+
+	for i, s := range services {
+		if s.Timeout == 0 {
+			shares[i] = budget * time.Duration(s.weight()) / time.Duration(weights)
+		}
+	}
+	return shares
+}
@@ -0,0 +1,177 @@
+package waitfor
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// availableAfter returns probe that succeeds d after it is created.
+func availableAfter(d time.Duration) Probe {
+	at := time.Now().Add(d)
+	return ProbeFunc(func(ctx context.Context) error {
+		if time.Now().Before(at) {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+}
+
+func TestBudgetShares(t *testing.T) {
+	shares := budgetShares(time.Second, []Service{
+		{Weight: 3},
+		{Timeout: time.Millisecond * 200},
+		{},
+	})
+	if shares[0] != time.Millisecond*600 || shares[1] != time.Millisecond*200 || shares[2] != time.Millisecond*200 {
+		t.Fatal("Wrong shares", shares)
+	}
+}
+
+func TestWaitBudget(t *testing.T) {
+	w := &Waiter{Timeout: time.Second, RetryAfter: time.Millisecond * 10}
+
+	// slow first service can not eat second's share
+	start := time.Now()
+	_, err := w.Wait(context.Background(),
+		Service{Name: "slow", Probe: availableAfter(time.Hour)},
+		Service{Name: "critical", Probe: availableAfter(0), Weight: 3},
+	)
+	if err == nil || !strings.Contains(err.Error(), "Service slow not available") {
+		t.Fatal("Expected slow service error", err)
+	}
+	if d := time.Since(start); d < time.Millisecond*200 || d > time.Millisecond*700 {
+		t.Fatal("Wrong share of slow service", d)
+	}
+
+	// time left by fast service is used by next one
+	_, err = w.Wait(context.Background(),
+		Service{Name: "fast", Probe: availableAfter(0)},
+		Service{Name: "late", Probe: availableAfter(time.Millisecond * 700)},
+	)
+	if err != nil {
+		t.Fatal("Services not available", err)
+	}
+
+	// own timeout
+	start = time.Now()
+	_, err = w.Wait(context.Background(),
+		Service{Name: "limited", Probe: availableAfter(time.Hour), Timeout: time.Millisecond * 100},
+	)
+	if err == nil || time.Since(start) > time.Millisecond*600 {
+		t.Fatal("Timeout not applied", err, time.Since(start))
+	}
+
+	// without budget services are not limited
+	w = &Waiter{RetryAfter: time.Millisecond * 10}
+	_, err = w.Wait(context.Background(),
+		Service{Name: "first", Probe: availableAfter(time.Millisecond * 100)},
+		Service{Name: "second", Target: "host=localhost port=364589", Timeout: time.Millisecond * 100},
+	)
+	if err == nil || !strings.Contains(err.Error(), "localhost:364589") {
+		t.Fatal("Expected second service error", err)
+	}
+}
+
+func TestWaitBudgetOversubscribed(t *testing.T) {
+	// Timeouts take whole budget, optional service is limited by MinShare
+	w := &Waiter{Timeout: time.Second, RetryAfter: time.Millisecond * 10}
+	report, err := w.Wait(context.Background(),
+		Service{Name: "db", Probe: availableAfter(0), Timeout: time.Second},
+		Service{Name: "cache", Probe: availableAfter(time.Hour), Optional: true},
+		Service{Name: "queue", Probe: availableAfter(0)},
+	)
+	if err != nil {
+		t.Fatal("Services not available", err)
+	}
+	if d := report.Services[1].Elapsed; d < MinShare || d > time.Millisecond*500 {
+		t.Fatal("Optional service took more than minimum share", d)
+	}
+	if !report.IsDegraded("cache") {
+		t.Fatal("Optional service not degraded", report.Services)
+	}
+}
+
+func TestWaitOptional(t *testing.T) {
+	w := &Waiter{Timeout: time.Second, RetryAfter: time.Millisecond * 10}
+
+	report, err := w.Wait(context.Background(),
+		Service{Name: "metrics", Probe: availableAfter(time.Hour), Optional: true},
+		Service{Name: "db", Probe: availableAfter(time.Millisecond * 100)},
+		Service{Name: "cache", Probe: availableAfter(0), Optional: true},
+	)
+	if err != nil {
+		t.Fatal("Optional service failed wait", err)
+	}
+	if d := report.Services[0].Elapsed; d > time.Millisecond*800 {
+		t.Fatal("Optional service took more than its share", d)
+	}
+
+	degraded := report.Degraded()
+	if len(degraded) != 1 || degraded[0] != "metrics" {
+		t.Fatal("Wrong degraded services", degraded)
+	}
+	if !report.IsDegraded("metrics") || report.IsDegraded("cache") || report.IsDegraded("db") {
+		t.Fatal("Wrong degraded state", report.Services)
+	}
+	if len(report.Services) != 3 || report.Services[0].Err == nil {
+		t.Fatal("Wrong report", report.Services)
+	}
+
+	report, err = w.Wait(context.Background(),
+		Service{Name: "cache", Probe: availableAfter(time.Hour), Optional: true, Timeout: time.Millisecond * 50},
+		Service{Name: "db", Probe: availableAfter(time.Hour)},
+	)
+	if err == nil || len(report.Services) != 2 || !report.IsDegraded("cache") {
+		t.Fatal("Required service did not fail wait", err, report.Services)
+	}
+}
+
+func TestWaitServicesWholeBudget(t *testing.T) {
+	ports, err := ReservePorts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	late := ports[0]
+	late.Release()
+	defer ports[1].Release()
+
+	// services started together: first one may take more than half of budget
+	go func() {
+		time.Sleep(time.Millisecond * 600)
+		l, err := net.Listen("tcp", late.Addr)
+		if err != nil {
+			return
+		}
+		time.Sleep(time.Second)
+		l.Close()
+	}()
+
+	err = WaitServices(time.Second*2, time.Millisecond*10, late.Addr, ports[1].Addr)
+	if err != nil {
+		t.Fatal("Services not available", err)
+	}
+}
+
+func TestWaitTargetRecordedByName(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	w := &Waiter{Timeout: time.Second, RetryAfter: time.Millisecond * 10, Registry: NewRegistry()}
+	report, err := w.Wait(context.Background(), Service{Name: "db", Target: l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := w.Registry.Snapshot()
+	if len(s.Endpoints) != 1 || s.Endpoints[0].Name != "db" || report.Services[0].Name != "db" {
+		t.Fatal("Service recorded under different name", s.Endpoints, report.Services)
+	}
+}
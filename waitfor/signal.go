@@ -0,0 +1,150 @@
+package waitfor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// ErrNotReady is returned by Signal's Probe while signal is not set.
+var ErrNotReady = errors.New("Not ready")
+
+// Signal is readiness latch. Server sets it once when it is ready or failed to start,
+// waiters block on it without polling. Zero value is signal that is not set.
+type Signal struct {
+	// Name identifies signal in registry. If empty, signal's address is used, so different
+	// signals are reported separately.
+	Name string
+
+	mu   sync.Mutex
+	set  bool
+	done chan struct{}
+	err  error
+}
+
+// NewSignal creates signal that is not set.
+func NewSignal() *Signal {
+	return &Signal{}
+}
+
+// Ready sets signal. Nil err means server is ready, otherwise server failed to start.
+// Only first call has effect.
+func (s *Signal) Ready(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.set {
+		return
+	}
+	s.set = true
+	s.err = err
+	close(s.channel())
+}
+
+// Done returns channel that is closed when signal is set.
+func (s *Signal) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channel()
+}
+
+// channel returns done channel, creating it on first use. s.mu must be held.
+func (s *Signal) channel() chan struct{} {
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+	return s.done
+}
+
+// Wait blocks until signal is set or ctx is done. Returns error passed to Ready or ctx's
+// error.
+func (s *Signal) Wait(ctx context.Context) error {
+	select {
+	case <-s.Done():
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Signal) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("signal %p", s)
+}
+
+// Probe returns ErrNotReady while signal is not set. Signal can be waited with
+// other services by Waiter, which wakes up as soon as signal is set. Startup failure
+// is permanent.
+func (s *Signal) Probe(ctx context.Context) error {
+	select {
+	case <-s.Done():
+		if s.err != nil {
+			return &signalError{err: s.err}
+		}
+		return nil
+	default:
+		return ErrNotReady
+	}
+}
+
+// Watch returns channel that is closed when signal is set.
+func (s *Signal) Watch(ctx context.Context) <-chan struct{} {
+	return s.Done()
+}
+
+// signalError is startup failure reported with Ready.
+type signalError struct {
+	err error
+}
+
+func (e *signalError) Error() string {
+	return "Server failed to start: " + e.err.Error()
+}
+
+func (e *signalError) Unwrap() error {
+	return e.err
+}
+
+// NotifyListener returns listener that sets s when server starts accepting connections,
+// that is on first call of Accept. If listener is closed before that, s is set with
+// net.ErrClosed.
+func NotifyListener(l net.Listener, s *Signal) net.Listener {
+	return &notifyListener{Listener: l, signal: s}
+}
+
+type notifyListener struct {
+	net.Listener
+	signal *Signal
+}
+
+func (l *notifyListener) Accept() (net.Conn, error) {
+	l.signal.Ready(nil)
+	return l.Listener.Accept()
+}
+
+func (l *notifyListener) Close() error {
+	l.signal.Ready(net.ErrClosed)
+	return l.Listener.Close()
+}
+
+// ListenAndServe listens on srv.Addr and serves srv, setting s when srv is ready or when
+// it fails to listen. Returns the same error as http.Server.ListenAndServe.
+func ListenAndServe(srv *http.Server, s *Signal) error {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.Ready(err)
+		return err
+	}
+	return srv.Serve(NotifyListener(l, s))
+}
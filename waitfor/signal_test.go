@@ -0,0 +1,124 @@
+package waitfor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+func TestSignal(t *testing.T) {
+	s := NewSignal()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := s.Wait(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatal("Signal is set", err)
+	}
+	if s.Probe(context.Background()) != ErrNotReady {
+		t.Fatal("Signal is set")
+	}
+
+	go func(s *Signal) {
+		time.Sleep(time.Millisecond * 100)
+		s.Ready(nil)
+		s.Ready(errors.New("ignored"))
+	}(s)
+
+	// waiter wakes up on signal, not after RetryAfter
+	start := time.Now()
+	err = WaitProbe(time.Second*5, time.Second*5, s)
+	if err != nil || time.Since(start) > time.Second {
+		t.Fatal("Signal not waited", err, time.Since(start))
+	}
+	if s.Wait(context.Background()) != nil {
+		t.Fatal("Signal failed")
+	}
+
+	s = NewSignal()
+	s.Ready(errors.New("bind failed"))
+	start = time.Now()
+	err = WaitProbe(time.Second*5, time.Millisecond*10, s)
+	if err == nil || !strings.Contains(err.Error(), "bind failed") || time.Since(start) > time.Second {
+		t.Fatal("Startup failure is not permanent", err)
+	}
+}
+
+func TestSignalZeroValue(t *testing.T) {
+	s := &Signal{Name: "api"}
+	if s.Probe(context.Background()) != ErrNotReady {
+		t.Fatal("Signal is set")
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		s.Ready(nil)
+	}()
+	err := WaitProbe(time.Second, time.Second, s)
+	if err != nil {
+		t.Fatal("Signal not waited", err)
+	}
+
+	var zero Signal
+	zero.Ready(errors.New("bind failed"))
+	if err := zero.Wait(context.Background()); err == nil || err.Error() != "bind failed" {
+		t.Fatal("Wrong signal error", err)
+	}
+}
+
+func TestNotifyListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSignal()
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go func() { _ = srv.Serve(NotifyListener(l, s)) }()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = s.Wait(ctx)
+	if err != nil {
+		t.Fatal("Server not ready", err)
+	}
+
+	resp, err := http.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// closed before serving
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = NewSignal()
+	NotifyListener(l, s).Close()
+	if s.Wait(ctx) != net.ErrClosed {
+		t.Fatal("Closed listener is ready")
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	ports, err := ReservePorts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ports[0].Listener()
+	defer l.Close()
+
+	// port is busy
+	s := NewSignal()
+	err = ListenAndServe(&http.Server{Addr: ports[0].Addr}, s)
+	if err == nil || s.Wait(context.Background()) != err {
+		t.Fatal("Listen failure not signaled", err)
+	}
+}
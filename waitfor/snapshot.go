@@ -0,0 +1,244 @@
+package waitfor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint states.
+const (
+	// StateUnknown is state of endpoint that was not checked yet.
+	StateUnknown EndpointState = iota
+	// StateUp is state of endpoint which last check succeeded.
+	StateUp
+	// StateDown is state of endpoint which last check failed.
+	StateDown
+)
+
+// DefaultRegistry records waits of Waiters without own Registry. Registry keeps every
+// endpoint it has seen for the life of the process, so code that waits for changing set of
+// endpoints (e.g. new database per tenant) should use own Registry and drop it when done.
+var DefaultRegistry = NewRegistry()
+
+// EndpointState is endpoint's state after last check.
+type EndpointState int
+
+// String returns state name.
+func (s EndpointState) String() string {
+	switch s {
+	case StateUp:
+		return "up"
+	case StateDown:
+		return "down"
+	}
+	return "unknown"
+}
+
+// MarshalText returns state name.
+func (s EndpointState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Endpoint is state of single endpoint.
+type Endpoint struct {
+	// Name is endpoint's address or probe's description.
+	Name  string        `json:"name"`
+	State EndpointState `json:"state"`
+	// Latency is duration of last check.
+	Latency time.Duration `json:"latency"`
+	// Error is text of last check's error, empty if check succeeded.
+	Error string `json:"error,omitempty"`
+	// Checked is time of last check.
+	Checked time.Time `json:"checked"`
+	// Changed is time of last state change.
+	Changed time.Time `json:"changed"`
+}
+
+// Readiness is snapshot of all known endpoints.
+type Readiness struct {
+	// Taken is time when snapshot was taken.
+	Taken time.Time `json:"taken"`
+	// Endpoints are sorted by name.
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Registry keeps state and metrics of endpoints checked by Waiters.
+type Registry struct {
+	mu        sync.Mutex
+	endpoints map[string]*Endpoint
+	waits     map[string]*waitMetrics
+}
+
+// NewRegistry creates empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		endpoints: map[string]*Endpoint{},
+		waits:     map[string]*waitMetrics{},
+	}
+}
+
+// Snapshot returns state of all endpoints known to DefaultRegistry.
+func Snapshot() Readiness {
+	return DefaultRegistry.Snapshot()
+}
+
+// Snapshot returns state of all known endpoints.
+func (r *Registry) Snapshot() Readiness {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Readiness{Taken: time.Now(), Endpoints: make([]Endpoint, 0, len(r.endpoints))}
+	for _, e := range r.endpoints {
+		s.Endpoints = append(s.Endpoints, *e)
+	}
+	sort.Slice(s.Endpoints, func(i, j int) bool {
+		return s.Endpoints[i].Name < s.Endpoints[j].Name
+	})
+	return s
+}
+
+// Record records result of single check of endpoint name. Waiters record their attempts,
+// checks made elsewhere (e.g. by circuit breaker) can be recorded too.
+func (r *Registry) Record(name string, err error, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.endpoints[name]
+	if !ok {
+		e = &Endpoint{Name: name}
+		r.endpoints[name] = e
+	}
+
+	now := time.Now()
+	state := StateUp
+	e.Error = ""
+	if err != nil {
+		state = StateDown
+		e.Error = err.Error()
+	}
+	if state != e.State {
+		e.State = state
+		e.Changed = now
+	}
+	e.Latency = latency
+	e.Checked = now
+}
+
+// String returns human readable report, one endpoint per line.
+func (s Readiness) String() string {
+	b := &strings.Builder{}
+	_, _ = s.WriteTo(b)
+	return b.String()
+}
+
+// WriteTo writes human readable report to w.
+func (s Readiness) WriteTo(w io.Writer) (int64, error) {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Readiness at %s\n", s.Taken.Format(time.RFC3339))
+	for _, e := range s.Endpoints {
+		fmt.Fprintf(b, "%-7s %s (latency %s, since %s)", e.State, e.Name,
+			e.Latency.Round(time.Microsecond), e.Changed.Format(time.RFC3339))
+		if e.Error != "" {
+			fmt.Fprintf(b, ": %s", e.Error)
+		}
+		b.WriteString("\n")
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Diff returns human readable report of changes between two snapshots: new and gone
+// endpoints, state changes and changed errors of endpoints that are still down.
+func Diff(before, after Readiness) string {
+	old := make(map[string]Endpoint, len(before.Endpoints))
+	for _, e := range before.Endpoints {
+		old[e.Name] = e
+	}
+
+	b := &strings.Builder{}
+	for _, e := range after.Endpoints {
+		o, ok := old[e.Name]
+		delete(old, e.Name)
+
+		switch {
+		case !ok:
+			fmt.Fprintf(b, "+ %s: %s", e.Name, e.State)
+		case o.State != e.State:
+			fmt.Fprintf(b, "~ %s: %s -> %s at %s", e.Name, o.State, e.State, e.Changed.Format(time.RFC3339))
+		case o.Error != e.Error:
+			fmt.Fprintf(b, "~ %s: still %s", e.Name, e.State)
+		default:
+			continue
+		}
+		if e.Error != "" {
+			fmt.Fprintf(b, ": %s", e.Error)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, e := range before.Endpoints {
+		if _, ok := old[e.Name]; ok {
+			fmt.Fprintf(b, "- %s\n", e.Name)
+		}
+	}
+
+	if b.Len() == 0 {
+		return fmt.Sprintf("No changes between %s and %s\n",
+			before.Taken.Format(time.RFC3339), after.Taken.Format(time.RFC3339))
+	}
+	return b.String()
+}
+
+// SnapshotHandler returns http.Handler that serves snapshot of r as text, or as json if
+// request accepts application/json.
+func SnapshotHandler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s := r.Snapshot()
+		if strings.Contains(req.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(s)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = s.WriteTo(w)
+	})
+}
+
+// probeName describes probe for registry.
+func probeName(p Probe) string {
+	switch p := p.(type) {
+	case *TCPProbe:
+		return p.Addr
+	case *TLSProbe:
+		return p.Addr
+	case *DNSProbe:
+		return p.Host
+	case *SRVProbe:
+		return p.Name
+	case *CommandProbe:
+		return p.command()
+	case *FileProbe:
+		return p.Path
+	case *GRPCHealthProbe:
+		return p.Addr + "/" + p.Service
+	case *LineProbe:
+		return p.Addr
+	case *ScriptProbe:
+		return p.Addr
+	case *PortFreeProbe:
+		return p.Addr
+	case *SQLProbe:
+		return p.name()
+	case *Signal:
+		return p.name()
+	}
+	return fmt.Sprintf("%T", p)
+}
@@ -0,0 +1,111 @@
+package waitfor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	w := &Waiter{Timeout: time.Millisecond * 200, RetryAfter: time.Millisecond * 10, Registry: NewRegistry()}
+
+	_ = w.WaitProbe(context.Background(), &TCPProbe{Addr: "127.0.0.1:1"})
+	_, _ = w.Wait(context.Background(), Service{Name: "cache", Probe: availableAfter(0)})
+	before := w.Registry.Snapshot()
+
+	if len(before.Endpoints) != 2 {
+		t.Fatal("Wrong endpoints", before.Endpoints)
+	}
+	down, up := before.Endpoints[0], before.Endpoints[1]
+	if down.Name != "127.0.0.1:1" || down.State != StateDown || down.Error == "" || down.Changed.IsZero() {
+		t.Fatal("Wrong down endpoint", down)
+	}
+	if up.Name != "cache" || up.State != StateUp || up.Error != "" {
+		t.Fatal("Wrong up endpoint", up)
+	}
+
+	text := before.String()
+	if !strings.Contains(text, "down    127.0.0.1:1") || !strings.Contains(text, "up      cache") {
+		t.Fatal("Wrong report", text)
+	}
+
+	report := Diff(before, w.Registry.Snapshot())
+	if !strings.HasPrefix(report, "No changes") {
+		t.Fatal("Wrong diff", report)
+	}
+
+	_ = w.WaitProbe(context.Background(), ProbeFunc(func(ctx context.Context) error { return nil }))
+	_, _ = w.Wait(context.Background(), Service{Name: "127.0.0.1:1", Probe: availableAfter(0)})
+	after := w.Registry.Snapshot()
+
+	report = Diff(before, after)
+	if !strings.Contains(report, "~ 127.0.0.1:1: down -> up") ||
+		!strings.Contains(report, "+ waitfor.ProbeFunc: up") ||
+		strings.Contains(report, "cache") {
+		t.Fatal("Wrong diff", report)
+	}
+
+	report = Diff(after, before)
+	if !strings.Contains(report, "- waitfor.ProbeFunc") || !strings.Contains(report, "up -> down") {
+		t.Fatal("Wrong diff", report)
+	}
+}
+
+func TestProbeName(t *testing.T) {
+	db1, _ := openFakeDB(t)
+	db2, err := sql.Open("waitfor-fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+
+	// name of unnamed database is stable
+	sql1, sql2 := probeName(&SQLProbe{DB: db1}), probeName(&SQLProbe{DB: db2})
+	if sql1 != "sql waitfor.fakeDriver" || sql1 != sql2 {
+		t.Fatal("Wrong database name", sql1, sql2)
+	}
+	if n := probeName(&SQLProbe{DB: db1, Name: "postgres://db:5432/app"}); n != "postgres://db:5432/app" {
+		t.Fatal("Name not used", n)
+	}
+
+	s1, s2 := NewSignal(), NewSignal()
+	if probeName(s1) == probeName(s2) {
+		t.Fatal("Signals not distinguished", probeName(s1))
+	}
+	s1.Name = "api"
+	if probeName(s1) != "api" {
+		t.Fatal("Name not used", probeName(s1))
+	}
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Record("db:5432", nil, time.Millisecond)
+
+	srv := httptest.NewServer(SnapshotHandler(r))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var s struct {
+		Endpoints []struct {
+			Name  string
+			State string
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	if err != nil || len(s.Endpoints) != 1 || s.Endpoints[0].Name != "db:5432" || s.Endpoints[0].State != "up" {
+		t.Fatal("Wrong snapshot", s, err)
+	}
+}
@@ -0,0 +1,284 @@
+package waitfor
+
+import (
+	"context"
+	"database/sql"
+	std_errors "errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// Queries returning true if database is read only, for use with Writable.
+const (
+	PostgresReadOnlyQuery = "SHOW transaction_read_only"
+	MySQLReadOnlyQuery    = "SELECT @@global.read_only OR @@global.super_read_only"
+)
+
+// SQLError kinds.
+const (
+	// SQLUnreachable means database could not be reached or did not respond in time.
+	SQLUnreachable SQLErrorKind = iota
+	// SQLRejected means database refused connection because of wrong credentials,
+	// unknown database or other configuration error. Such errors are not retried.
+	SQLRejected
+	// SQLNotReady means database is reachable but some of checks failed.
+	SQLNotReady
+)
+
+// matches error messages of popular drivers for authentication and configuration errors
+var regexSQLRejected = regexp.MustCompile(`(?i)(authentication failed|access denied|login failed|` +
+	`unknown database|database "[^"]*" does not exist|role "[^"]*" does not exist|` +
+	`no pg_hba\.conf entry|\(28000\)|\(28P01\))`)
+
+// SQLCheck is additional check run by WaitSQL after successful ping.
+type SQLCheck func(ctx context.Context, db *sql.DB) error
+
+// SQLErrorKind tells why database is not available.
+type SQLErrorKind int
+
+// SQLError is returned by WaitSQL and SQLProbe.
+type SQLError struct {
+	Kind SQLErrorKind
+	Err  error
+}
+
+// Error returns error's text
+func (e *SQLError) Error() string {
+	msg := "DB is not available"
+	switch e.Kind {
+	case SQLRejected:
+		msg = "DB rejected connection"
+	case SQLNotReady:
+		msg = "DB is not ready"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Cause returns driver's or check's error.
+func (e *SQLError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the same error as Cause.
+func (e *SQLError) Unwrap() error {
+	return e.Err
+}
+
+// SQLProbe pings database and runs checks.
+type SQLProbe struct {
+	DB     *sql.DB
+	Checks []SQLCheck
+	// Name identifies database in registry, e.g. Redact(dsn). If empty, driver's type is
+	// used, so databases with the same driver should be named to be reported separately.
+	Name string
+}
+
+func (p *SQLProbe) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	if p.DB == nil {
+		return "sql"
+	}
+	return fmt.Sprintf("sql %T", p.DB.Driver())
+}
+
+// Probe pings database and runs checks. Returns *SQLError.
+func (p *SQLProbe) Probe(ctx context.Context) error {
+	err := p.DB.PingContext(ctx)
+	if err != nil {
+		if sqlRejected(err) {
+			return &SQLError{Kind: SQLRejected, Err: err}
+		}
+		return &SQLError{Kind: SQLUnreachable, Err: err}
+	}
+
+	err = runSQLChecks(ctx, p.DB, p.Checks)
+	if err != nil {
+		return &SQLError{Kind: SQLNotReady, Err: err}
+	}
+	return nil
+}
+
+// sqlRejected reports whether ping error is authentication or configuration error.
+// SQLSTATE is used if driver's error provides it (pgx), otherwise error message is checked.
+func sqlRejected(err error) bool {
+	var se interface{ SQLState() string }
+	if std_errors.As(err, &se) {
+		state := se.SQLState()
+		// 28 - invalid authorization specification, 3D - invalid catalog name
+		return strings.HasPrefix(state, "28") || strings.HasPrefix(state, "3D")
+	}
+	return regexSQLRejected.MatchString(err.Error())
+}
+
+// QueryReturnsRows checks that query returns at least one row.
+func QueryReturnsRows(query string, args ...interface{}) SQLCheck {
+	return QueryMatches(query, func(rows *sql.Rows) (bool, error) {
+		return rows.Next(), nil
+	}, args...)
+}
+
+// QueryMatches runs query and checks its rows with pred. Pred must not close rows.
+func QueryMatches(query string, pred func(rows *sql.Rows) (bool, error), args ...interface{}) SQLCheck {
+	return func(ctx context.Context, db *sql.DB) (err error) {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return errors.Wrapf(err, "Query %q failed: ", query)
+		}
+		defer func() { err = errors.Join(err, rows.Close()) }()
+
+		ok, err := pred(rows)
+		if err == nil {
+			err = rows.Err()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Query %q failed: ", query)
+		}
+		if !ok {
+			return errors.Newf("Query %q result does not match", query)
+		}
+		return nil
+	}
+}
+
+// MinSchemaVersion checks that maximum version in schema_migrations table (as used by
+// golang-migrate, Rails and others) is not less than version. If table has dirty column
+// (golang-migrate), dirty version means failed or unfinished migration and is not ready.
+func MinSchemaVersion(version int64) SQLCheck {
+	return func(ctx context.Context, db *sql.DB) (err error) {
+		// version is bigint or varchar and dirty column exists or not depending on tool,
+		// so columns are found by name and max is found here
+		rows, err := db.QueryContext(ctx, "SELECT * FROM schema_migrations")
+		if err != nil {
+			return errors.Wrap(err, "Can not read schema version: ")
+		}
+		defer func() { err = errors.Join(err, rows.Close()) }()
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Wrap(err, "Can not read schema version: ")
+		}
+		versionCol, dirtyCol := -1, -1
+		for i, c := range cols {
+			switch strings.ToLower(c) {
+			case "version":
+				versionCol = i
+			case "dirty":
+				dirtyCol = i
+			}
+		}
+		if versionCol < 0 {
+			return errors.New("Can not read schema version: schema_migrations has no version column")
+		}
+
+		values := make([]sql.NullString, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		current := int64(-1)
+		for rows.Next() {
+			err = rows.Scan(dest...)
+			if err != nil {
+				return errors.Wrap(err, "Can not read schema version: ")
+			}
+
+			s := strings.TrimSpace(values[versionCol].String)
+			v, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "Can not parse schema version: ")
+			}
+			if dirtyCol >= 0 {
+				dirty, ok := parseSQLBool(values[dirtyCol].String)
+				if !ok {
+					return errors.Newf("Can not parse dirty flag of schema version %d: %q", v, values[dirtyCol].String)
+				}
+				if dirty {
+					return errors.Newf("Schema version %d is dirty, migration failed or is in progress", v)
+				}
+			}
+			if v > current {
+				current = v
+			}
+		}
+		err = rows.Err()
+		if err != nil {
+			return errors.Wrap(err, "Can not read schema version: ")
+		}
+
+		if current < version {
+			return errors.Newf("Schema version is %d, expected at least %d", current, version)
+		}
+		return nil
+	}
+}
+
+// TablesExist checks that all tables exist. Table names are used in query as is, so they
+// must be properly quoted if needed.
+func TablesExist(tables ...string) SQLCheck {
+	return func(ctx context.Context, db *sql.DB) error {
+		for _, t := range tables {
+			rows, err := db.QueryContext(ctx, "SELECT 1 FROM "+t+" WHERE 1 = 0")
+			if err != nil {
+				return errors.Wrapf(err, "Table %s not available: ", t)
+			}
+			err = rows.Close()
+			if err != nil {
+				return errors.Wrapf(err, "Table %s not available: ", t)
+			}
+		}
+		return nil
+	}
+}
+
+// Writable checks that database accepts writes (is not read only replica). Query must return
+// single boolean value that is true for read only database, see PostgresReadOnlyQuery and
+// MySQLReadOnlyQuery.
+func Writable(readOnlyQuery string) SQLCheck {
+	return func(ctx context.Context, db *sql.DB) error {
+		var s string
+		err := db.QueryRowContext(ctx, readOnlyQuery).Scan(&s)
+		if err != nil {
+			return errors.Wrap(err, "Can not check if database is read only: ")
+		}
+
+		readOnly, ok := parseSQLBool(s)
+		if !ok {
+			return errors.Newf("Can not check if database is read only: unexpected result %q", s)
+		}
+		if readOnly {
+			return errors.New("Database is read only")
+		}
+		return nil
+	}
+}
+
+// parseSQLBool parses boolean value as returned by popular databases.
+func parseSQLBool(s string) (value, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "0", "f", "false", "off":
+		return false, true
+	case "1", "t", "true", "on":
+		return true, true
+	}
+	return false, false
+}
+
+func runSQLChecks(ctx context.Context, db *sql.DB, checks []SQLCheck) error {
+	for _, c := range checks {
+		err := c(ctx, db)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
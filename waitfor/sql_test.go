@@ -0,0 +1,349 @@
+package waitfor
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// fakeDB is database/sql driver's backend for tests. Every DSN opens own fakeDB.
+type fakeDB struct {
+	mu       sync.Mutex
+	pingErr  error
+	pingHang bool
+	results  map[string]fakeResult
+}
+
+type fakeResult struct {
+	cols []string
+	rows [][]driver.Value
+	err  error
+}
+
+var (
+	fakeDBs  = map[string]*fakeDB{}
+	fakeDBMu sync.Mutex
+)
+
+func init() {
+	sql.Register("waitfor-fake", fakeDriver{})
+}
+
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	fdb := &fakeDB{results: map[string]fakeResult{}}
+
+	fakeDBMu.Lock()
+	fakeDBs[t.Name()] = fdb
+	fakeDBMu.Unlock()
+
+	db, err := sql.Open("waitfor-fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, fdb
+}
+
+func (f *fakeDB) SetPingErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pingErr = err
+}
+
+func (f *fakeDB) SetPingHang(hang bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pingHang = hang
+}
+
+func (f *fakeDB) SetResult(query string, res fakeResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[query] = res
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBMu.Lock()
+	defer fakeDBMu.Unlock()
+	return &fakeConn{db: fakeDBs[name]}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	c.db.mu.Lock()
+	hang := c.db.pingHang
+	err := c.db.pingErr
+	c.db.mu.Unlock()
+
+	if hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	res, ok := c.db.results[query]
+	if !ok {
+		return nil, errors.New("relation does not exist: " + query)
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	return &fakeRows{cols: res.cols, rows: res.rows}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.cols
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestWaitSQL(t *testing.T) {
+	db, fdb := openFakeDB(t)
+	fdb.SetPingErr(errors.New("connection refused"))
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		fdb.SetPingErr(nil)
+	}()
+
+	err := WaitSQL(time.Second, time.Millisecond*50, db)
+	if err != nil {
+		t.Fatal("DB not available", err)
+	}
+}
+
+func TestWaitSQLNamed(t *testing.T) {
+	db, _ := openFakeDB(t)
+
+	err := WaitSQLNamed(time.Second, time.Millisecond*50, "orders-db", db)
+	if err != nil {
+		t.Fatal("DB not available", err)
+	}
+	for _, e := range Snapshot().Endpoints {
+		if e.Name == "orders-db" {
+			return
+		}
+	}
+	t.Fatal("DB not recorded under its name", Snapshot())
+}
+
+func TestWaitSQLChecks(t *testing.T) {
+	db, fdb := openFakeDB(t)
+
+	fdb.SetResult("SELECT * FROM schema_migrations", fakeResult{
+		cols: []string{"version"},
+		rows: [][]driver.Value{{"20200101"}, {"20210101"}},
+	})
+	fdb.SetResult("SELECT 1 FROM users WHERE 1 = 0", fakeResult{cols: []string{"1"}})
+	fdb.SetResult(PostgresReadOnlyQuery, fakeResult{
+		cols: []string{"transaction_read_only"},
+		rows: [][]driver.Value{{"off"}},
+	})
+	fdb.SetResult("SELECT count(*) FROM jobs", fakeResult{
+		cols: []string{"count"},
+		rows: [][]driver.Value{{int64(0)}},
+	})
+
+	err := WaitSQL(time.Second, time.Millisecond*50, db,
+		MinSchemaVersion(20210101),
+		TablesExist("users"),
+		Writable(PostgresReadOnlyQuery),
+		QueryReturnsRows("SELECT count(*) FROM jobs"),
+	)
+	if err != nil {
+		t.Fatal("DB not ready", err)
+	}
+
+	err = WaitSQL(time.Millisecond*200, time.Millisecond*50, db, MinSchemaVersion(20220101))
+	if err == nil || !strings.Contains(err.Error(), "Schema version is 20210101") {
+		t.Fatal("Expected schema version error", err)
+	}
+
+	// golang-migrate's table with failed migration
+	fdb.SetResult("SELECT * FROM schema_migrations", fakeResult{
+		cols: []string{"version", "dirty"},
+		rows: [][]driver.Value{{int64(20210101), true}},
+	})
+	err = WaitSQL(time.Millisecond*200, time.Millisecond*50, db, MinSchemaVersion(20210101))
+	if err == nil || !strings.Contains(err.Error(), "Schema version 20210101 is dirty") {
+		t.Fatal("Dirty schema version accepted", err)
+	}
+
+	fdb.SetResult("SELECT * FROM schema_migrations", fakeResult{
+		cols: []string{"version", "dirty"},
+		rows: [][]driver.Value{{int64(20210101), false}},
+	})
+	err = WaitSQL(time.Millisecond*200, time.Millisecond*50, db, MinSchemaVersion(20210101))
+	if err != nil {
+		t.Fatal("Clean schema version not accepted", err)
+	}
+
+	err = WaitSQL(time.Millisecond*200, time.Millisecond*50, db, TablesExist("users", "orders"))
+	if err == nil || !strings.Contains(err.Error(), "Table orders not available") {
+		t.Fatal("Expected table error", err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		fdb.SetResult("SELECT count(*) FROM jobs", fakeResult{
+			cols: []string{"count"},
+			rows: [][]driver.Value{{int64(3)}},
+		})
+	}()
+
+	err = WaitSQL(time.Second, time.Millisecond*50, db,
+		QueryMatches("SELECT count(*) FROM jobs", func(rows *sql.Rows) (bool, error) {
+			var n int
+			if !rows.Next() {
+				return false, nil
+			}
+			err := rows.Scan(&n)
+			return n >= 3, err
+		}))
+	if err != nil {
+		t.Fatal("Predicate not matched", err)
+	}
+
+	fdb.SetResult(PostgresReadOnlyQuery, fakeResult{
+		cols: []string{"transaction_read_only"},
+		rows: [][]driver.Value{{"on"}},
+	})
+	err = WaitSQL(time.Millisecond*200, time.Millisecond*50, db, Writable(PostgresReadOnlyQuery))
+	if err == nil || !strings.Contains(err.Error(), "read only") {
+		t.Fatal("Read only database accepted", err)
+	}
+}
+
+type pgError struct {
+	code string
+}
+
+func (e *pgError) Error() string {
+	return "server error (SQLSTATE " + e.code + ")"
+}
+
+func (e *pgError) SQLState() string {
+	return e.code
+}
+
+func TestWaitSQLRejected(t *testing.T) {
+	db, fdb := openFakeDB(t)
+
+	fdb.SetPingErr(errors.New(`pq: password authentication failed for user "app"`))
+	start := time.Now()
+	err := WaitSQL(time.Second*5, time.Millisecond*50, db)
+	sqlErr, ok := err.(*SQLError)
+	if !ok || sqlErr.Kind != SQLRejected {
+		t.Fatal("Expected rejected error", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Rejected connection was retried", time.Since(start))
+	}
+
+	fdb.SetPingErr(&pgError{code: "3D000"})
+	err = WaitSQL(time.Second*5, time.Millisecond*50, db)
+	sqlErr, ok = err.(*SQLError)
+	if !ok || sqlErr.Kind != SQLRejected {
+		t.Fatal("Expected rejected error", err)
+	}
+
+	fdb.SetPingErr(&pgError{code: "57P03"}) // cannot connect now
+	err = WaitSQL(time.Millisecond*200, time.Millisecond*50, db)
+	sqlErr, ok = err.(*SQLError)
+	if !ok || sqlErr.Kind != SQLUnreachable {
+		t.Fatal("Expected unreachable error", err)
+	}
+}
+
+func TestSQLErrorWithoutCause(t *testing.T) {
+	err := &SQLError{Kind: SQLNotReady}
+	if err.Error() != "DB is not ready" {
+		t.Fatal("Wrong error text", err.Error())
+	}
+}
+
+func TestWaitSQLAttemptTimeout(t *testing.T) {
+	db, fdb := openFakeDB(t)
+	fdb.SetPingHang(true)
+
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		fdb.SetPingHang(false)
+	}()
+
+	w := &Waiter{
+		Timeout:        time.Second,
+		AttemptTimeout: time.Millisecond * 100,
+		RetryAfter:     time.Millisecond * 10,
+	}
+	err := w.WaitSQL(context.Background(), db)
+	if err != nil {
+		t.Fatal("DB not available", err)
+	}
+
+	fdb.SetPingHang(true)
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		fdb.SetPingHang(false)
+	}()
+	err = WaitSQLAttempts(time.Second, time.Millisecond*100, time.Millisecond*10, "app", db)
+	if err != nil {
+		t.Fatal("DB not available", err)
+	}
+
+	fdb.SetPingHang(true)
+	start := time.Now()
+	err = WaitSQL(time.Millisecond*200, time.Second*5, db)
+	sqlErr, ok := err.(*SQLError)
+	if !ok || sqlErr.Kind != SQLUnreachable {
+		t.Fatal("Expected unreachable error", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Wait continued after deadline", time.Since(start))
+	}
+}
@@ -0,0 +1,148 @@
+package waitfor
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+// SRV wait modes.
+const (
+	// SRVAny waits for any of discovered members.
+	SRVAny = "any"
+	// SRVAll waits for all discovered members.
+	SRVAll = "all"
+	// SRVQuorum waits for SRVProbe.Quorum members (majority by default).
+	SRVQuorum = "quorum"
+)
+
+var regexSRVScheme = regexp.MustCompile(`^srv\+tcp://`)
+
+// SRVProbe resolves SRV records to host/port pairs and checks that required number of
+// them accepts tcp connections.
+type SRVProbe struct {
+	// Name is full SRV name, like _postgres._tcp.db.internal.
+	Name string
+	// Mode is one of SRVAny, SRVAll, SRVQuorum. Default is SRVAny.
+	Mode string
+	// Quorum is number of members required in SRVQuorum mode. Default is majority.
+	Quorum int
+	// Resolver is used for SRV and members lookups. If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+	// Dialer is used to connect to members. If nil, direct connection is used.
+	Dialer Dialer
+}
+
+// Probe resolves members and checks them.
+func (p *SRVProbe) Probe(ctx context.Context) error {
+	r := p.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	_, srvs, err := r.LookupSRV(ctx, "", "", p.Name)
+	if err != nil {
+		return &ResolveError{Host: p.Name, Type: RecordSRV, Err: err}
+	}
+
+	need := p.required(len(srvs))
+	if need == 0 {
+		return &ResolveError{Host: p.Name, Type: RecordSRV, Expected: 1}
+	}
+
+	ready := 0
+	me := &errors.MultiError{}
+	for _, srv := range srvs {
+		port := strconv.Itoa(int(srv.Port))
+		err := p.probeMember(ctx, r, srv.Target, port)
+		if err != nil {
+			me.Add(errors.Wrapf(err, "member %s:%s: ", srv.Target, port))
+			continue
+		}
+
+		ready++
+		if ready >= need {
+			return nil
+		}
+	}
+
+	if me.ActualLen() == 0 {
+		// all members are ready, but more of them must register
+		return errors.Newf("%d of %d members of %s ready, required %d",
+			ready, len(srvs), p.Name, need)
+	}
+	return errors.Wrapf(me, "%d of %d members of %s ready, required %d: ",
+		ready, len(srvs), p.Name, need)
+}
+
+func (p *SRVProbe) required(total int) int {
+	switch p.Mode {
+	case SRVAll:
+		return total
+	case SRVQuorum:
+		if p.Quorum > 0 {
+			return p.Quorum
+		}
+		return total/2 + 1
+	}
+
+	if total > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (p *SRVProbe) probeMember(ctx context.Context, r *net.Resolver, host, port string) error {
+	if p.Dialer != nil {
+		// let proxy resolve member the same way it does for real clients
+		return dialTCP(ctx, p.Dialer, net.JoinHostPort(host, port))
+	}
+
+	addrs, err := r.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range addrs {
+		err = dialTCP(ctx, p.Dialer, net.JoinHostPort(a.IP.String(), port))
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// parseSRVService parses srv+tcp://_service._proto.name?mode=all&quorum=2
+func parseSRVService(s string) (*SRVProbe, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("Can not parse service connection string: " + Redact(s))
+	}
+
+	q := u.Query()
+	p := &SRVProbe{
+		Name: u.Host,
+		Mode: q.Get("mode"),
+	}
+
+	if qs := q.Get("quorum"); qs != "" {
+		p.Quorum, err = strconv.Atoi(qs)
+		if err != nil {
+			return nil, errors.New("Wrong quorum in service connection string: " + Redact(s))
+		}
+		if p.Mode == "" {
+			p.Mode = SRVQuorum
+		}
+	}
+
+	switch p.Mode {
+	case "", SRVAny, SRVAll, SRVQuorum:
+	default:
+		return nil, errors.New("Unknown mode in service connection string: " + Redact(s))
+	}
+	return p, nil
+}
@@ -0,0 +1,100 @@
+package waitfor
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSRVProbe(t *testing.T) {
+	stub := startDNSStub(t)
+	defer stub.Close()
+
+	lone, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lone.Close()
+
+	ltwo, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoAddr := ltwo.Addr().(*net.TCPAddr)
+	ltwo.Close()
+
+	stub.AddA("node1.test.", net.IPv4(127, 0, 0, 1))
+	stub.AddA("node2.test.", net.IPv4(127, 0, 0, 1))
+	stub.AddSRV("_pg._tcp.cluster.test.", uint16(lone.Addr().(*net.TCPAddr).Port), "node1.test.")
+	stub.AddSRV("_pg._tcp.cluster.test.", uint16(twoAddr.Port), "node2.test.")
+
+	p := &SRVProbe{Name: "_pg._tcp.cluster.test.", Resolver: stub.Resolver()}
+	err = WaitProbe(time.Second, time.Millisecond*100, p)
+	if err != nil {
+		t.Fatal("Any member not available", err)
+	}
+
+	p.Mode = SRVAll
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*100, p)
+	if err == nil {
+		t.Fatal("All members available while one is down")
+	}
+
+	p.Mode = SRVQuorum
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*100, p)
+	if err == nil {
+		t.Fatal("Quorum available while one of two is down")
+	}
+
+	p.Quorum = 1
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*100, p)
+	if err != nil {
+		t.Fatal("Quorum of one not available", err)
+	}
+
+	ltwo, err = net.ListenTCP("tcp", twoAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ltwo.Close()
+
+	p.Mode = SRVAll
+	err = WaitProbe(time.Second, time.Millisecond*100, p)
+	if err != nil {
+		t.Fatal("All members not available", err)
+	}
+	// quorum larger than number of members waits for members that register later
+	p.Mode = SRVQuorum
+	p.Quorum = 3
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		stub.AddSRV("_pg._tcp.cluster.test.", uint16(twoAddr.Port), "node2.test.")
+	}()
+	start := time.Now()
+	err = WaitProbe(time.Second*2, time.Millisecond*50, p)
+	if err != nil || time.Since(start) < time.Millisecond*250 {
+		t.Fatal("Quorum not waited", err, time.Since(start))
+	}
+}
+
+func TestParseSRVService(t *testing.T) {
+	p, err := parseSRVService("srv+tcp://_postgres._tcp.db.internal")
+	if err != nil || p.Name != "_postgres._tcp.db.internal" || p.Mode != "" {
+		t.Fatal("Wrong srv service", p, err)
+	}
+
+	p, err = parseSRVService("srv+tcp://_postgres._tcp.db.internal?mode=all")
+	if err != nil || p.Mode != SRVAll {
+		t.Fatal("Wrong srv service", p, err)
+	}
+
+	p, err = parseSRVService("srv+tcp://_postgres._tcp.db.internal?quorum=2")
+	if err != nil || p.Mode != SRVQuorum || p.Quorum != 2 {
+		t.Fatal("Wrong srv service", p, err)
+	}
+
+	_, err = parseSRVService("srv+tcp://_postgres._tcp.db.internal?mode=some")
+	if err == nil {
+		t.Fatal("Wrong mode parsed")
+	}
+}
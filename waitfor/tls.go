@@ -0,0 +1,218 @@
+package waitfor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	std_errors "errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+)
+
+var (
+	regexTLSScheme  = regexp.MustCompile(`^(https|rediss|amqps)://`)
+	regexSSLMode    = regexp.MustCompile(`sslmode=(require|verify-ca|verify-full)(\s|&|$)`)
+	postgresSSLCode = []byte{0, 0, 0, 8, 4, 210, 22, 47}
+)
+
+// TLSProbe checks that TLS handshake with service succeeds and that service's
+// certificate meets expectations.
+type TLSProbe struct {
+	// Addr is service address in host:port form.
+	Addr string
+	// Config is used for handshake. If nil, empty config (system roots) is used.
+	Config *tls.Config
+	// ServerName is sent as SNI and verified against certificate. If empty, Config.ServerName
+	// or host from Addr is used.
+	ServerName string
+	// SAN if not empty must be one of leaf certificate's subject alternative names.
+	SAN string
+	// MinValidity is minimum time leaf certificate must remain valid.
+	MinValidity time.Duration
+	// Negotiate if not nil is called before handshake, for protocols that
+	// upgrade plain connection to TLS (see PostgresSSLRequest).
+	Negotiate func(conn net.Conn) error
+	// Dialer is used to connect to service. If nil, direct connection is used.
+	Dialer Dialer
+}
+
+// CertificateError describes why service's certificate was rejected.
+type CertificateError struct {
+	Addr     string
+	Subject  string
+	NotAfter time.Time
+	Reason   string
+	Err      error
+}
+
+// Error returns error's text
+func (e *CertificateError) Error() string {
+	return fmt.Sprintf("Certificate of %s (subject %q, valid until %s) rejected: %s",
+		e.Addr, e.Subject, e.NotAfter.Format(time.RFC3339), e.Reason)
+}
+
+// Cause returns verification error reported by crypto/tls, if any.
+func (e *CertificateError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the same error as Cause.
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
+
+// Probe performs TLS handshake and checks certificate.
+func (p *TLSProbe) Probe(ctx context.Context) (err error) {
+	conn, err := dialer(p.Dialer).DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	done := closeOnDone(ctx, conn)
+	defer func() { err = done(err) }()
+
+	if p.Negotiate != nil {
+		err = p.Negotiate(conn)
+		if err != nil {
+			return errors.Wrapf(err, "TLS negotiation with %s failed: ", p.Addr)
+		}
+	}
+
+	tc := tls.Client(conn, p.config())
+	err = tc.HandshakeContext(ctx)
+	if err != nil {
+		var ve *tls.CertificateVerificationError
+		if std_errors.As(err, &ve) && len(ve.UnverifiedCertificates) > 0 {
+			return p.certError(ve.UnverifiedCertificates[0], ve.Err.Error(), err)
+		}
+		return errors.Wrapf(err, "TLS handshake with %s failed: ", p.Addr)
+	}
+
+	return p.checkCertificate(tc.ConnectionState())
+}
+
+func (p *TLSProbe) config() *tls.Config {
+	cfg := &tls.Config{}
+	if p.Config != nil {
+		cfg = p.Config.Clone()
+	}
+	if p.ServerName != "" {
+		cfg.ServerName = p.ServerName
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(p.Addr)
+		if err == nil {
+			cfg.ServerName = host
+		}
+	}
+	return cfg
+}
+
+func (p *TLSProbe) checkCertificate(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.Newf("Service %s presented no certificate", p.Addr)
+	}
+
+	leaf := cs.PeerCertificates[0]
+	if p.SAN != "" {
+		err := leaf.VerifyHostname(p.SAN)
+		if err != nil {
+			reason := fmt.Sprintf("%q not in SAN (DNS names %v, IP addresses %v)",
+				p.SAN, leaf.DNSNames, leaf.IPAddresses)
+			return p.certError(leaf, reason, err)
+		}
+	}
+
+	if p.MinValidity > 0 {
+		left := time.Until(leaf.NotAfter)
+		if left < p.MinValidity {
+			reason := fmt.Sprintf("expires in %s, required at least %s",
+				left.Round(time.Second), p.MinValidity)
+			return p.certError(leaf, reason, nil)
+		}
+	}
+
+	return nil
+}
+
+func (p *TLSProbe) certError(cert *x509.Certificate, reason string, err error) error {
+	return &CertificateError{
+		Addr:     p.Addr,
+		Subject:  cert.Subject.String(),
+		NotAfter: cert.NotAfter,
+		Reason:   reason,
+		Err:      err,
+	}
+}
+
+// PostgresSSLRequest asks PostgreSQL server to switch connection to TLS. It can be used as
+// TLSProbe.Negotiate.
+func PostgresSSLRequest(conn net.Conn) error {
+	_, err := conn.Write(postgresSSLCode)
+	if err != nil {
+		return err
+	}
+
+	resp := make([]byte, 1)
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		return err
+	}
+	if resp[0] != 'S' {
+		return errors.New("server does not support SSL")
+	}
+	return nil
+}
+
+// tlsServiceProbe returns TLSProbe for connection strings that require TLS or nil
+// for plain tcp services.
+func tlsServiceProbe(s, host, port string) *TLSProbe {
+	if regexTLSScheme.MatchString(s) {
+		return &TLSProbe{Addr: host + ":" + port}
+	}
+
+	m := regexSSLMode.FindStringSubmatch(s)
+	if m == nil {
+		return nil
+	}
+
+	p := &TLSProbe{
+		Addr:      host + ":" + port,
+		Negotiate: PostgresSSLRequest,
+	}
+	switch m[1] {
+	case "require":
+		// same as libpq: encryption without certificate verification
+		p.Config = &tls.Config{InsecureSkipVerify: true}
+	case "verify-ca":
+		p.Config = &tls.Config{InsecureSkipVerify: true, VerifyConnection: verifyChain}
+	}
+	return p
+}
+
+// verifyChain verifies server's certificate chain against system roots without checking
+// host name, as libpq does for sslmode=verify-ca.
+func verifyChain(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	opts := x509.VerifyOptions{Intermediates: x509.NewCertPool()}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	if err != nil {
+		return &tls.CertificateVerificationError{UnverifiedCertificates: cs.PeerCertificates, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package waitfor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/waitfor/waitfortest"
+)
+
+func TestTLSProbe(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	addr := srv.Listener.Addr().String()
+
+	err := WaitProbe(time.Second, time.Millisecond*100, &TLSProbe{
+		Addr:        addr,
+		Config:      &tls.Config{RootCAs: roots},
+		ServerName:  "example.com",
+		SAN:         "127.0.0.1",
+		MinValidity: time.Hour,
+	})
+	if err != nil {
+		t.Fatal("TLS service not available", err)
+	}
+
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*100, &TLSProbe{Addr: addr})
+	cerr, ok := err.(*CertificateError)
+	if !ok {
+		t.Fatal("Expected certificate error for unknown authority", err)
+	}
+	if cerr.Addr != addr || cerr.Subject == "" {
+		t.Fatal("Wrong certificate error", cerr)
+	}
+
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*100, &TLSProbe{
+		Addr:   addr,
+		Config: &tls.Config{RootCAs: roots},
+		SAN:    "other.com",
+	})
+	if err == nil || !strings.Contains(err.Error(), `"other.com" not in SAN`) {
+		t.Fatal("Expected SAN error", err)
+	}
+
+	err = WaitProbe(time.Millisecond*300, time.Millisecond*100, &TLSProbe{
+		Addr:        addr,
+		Config:      &tls.Config{RootCAs: roots},
+		MinValidity: time.Hour * 24 * 365 * 200,
+	})
+	if err == nil || !strings.Contains(err.Error(), "expires in") {
+		t.Fatal("Expected validity error", err)
+	}
+}
+
+func TestWaitServicesTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	addrParts := strings.Split(srv.Listener.Addr().String(), ":")
+	err := WaitServices(
+		time.Millisecond*300, time.Millisecond*100,
+		"https://127.0.0.1:"+addrParts[1]+"/some")
+	if err == nil || !strings.Contains(err.Error(), "Certificate of") {
+		t.Fatal("Service with untrusted certificate available", err)
+	}
+}
+
+// startPostgresTLS starts server that accepts PostgreSQL SSLRequest and TLS handshakes with
+// self signed certificate. Returns server's port.
+func startPostgresTLS(t *testing.T) string {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+	cfg := srv.TLS
+
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				req := make([]byte, len(postgresSSLCode))
+				_, err = io.ReadFull(conn, req)
+				if err != nil || string(req) != string(postgresSSLCode) {
+					return
+				}
+				_, _ = conn.Write([]byte{'S'})
+				_ = tls.Server(conn, cfg).Handshake()
+			}()
+		}
+	}()
+
+	return strings.Split(l.Addr().String(), ":")[1]
+}
+
+func TestPostgresSSLRequest(t *testing.T) {
+	port := startPostgresTLS(t)
+
+	err := WaitServices(
+		time.Second, time.Millisecond*100,
+		"host=localhost port="+port+" sslmode=require")
+	if err != nil {
+		t.Fatal("Postgres TLS not available", err)
+	}
+
+	// self signed certificate is not trusted, host name is not checked
+	err = WaitServices(
+		time.Millisecond*300, time.Millisecond*100,
+		"host=localhost port="+port+" sslmode=verify-ca")
+	if err == nil || !strings.Contains(err.Error(), "unknown authority") {
+		t.Fatal("Expected chain verification error", err)
+	}
+}
+
+func TestPostgresSSLRequestCancel(t *testing.T) {
+	srv := waitfortest.NewServer(waitfortest.Config{
+		Schedule: []waitfortest.Step{{Mode: waitfortest.HalfOpen}},
+	})
+	defer srv.Close()
+
+	// ctx without deadline, canceled while server never answers SSLRequest
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+
+	p := &TLSProbe{Addr: srv.Addr, Negotiate: PostgresSSLRequest}
+	start := time.Now()
+	err := p.Probe(ctx)
+	if err != context.Canceled || time.Since(start) > time.Second {
+		t.Fatal("Probe not canceled", err, time.Since(start))
+	}
+}
@@ -0,0 +1,235 @@
+package waitfor
+
+import (
+	"context"
+	"database/sql"
+	std_errors "errors"
+	"net"
+	"time"
+
+	"github.com/hummerd/gostuff/errors"
+	"github.com/hummerd/gostuff/retry"
+)
+
+// Waiter waits for services with shared settings. Zero Waiter retries immediately
+// until context is done.
+type Waiter struct {
+	// Timeout limits whole wait. Zero means no limit besides context.
+	Timeout time.Duration
+	// AttemptTimeout limits single probe's attempt. Zero means attempt is limited
+	// only by Timeout.
+	AttemptTimeout time.Duration
+	// RetryAfter is pause between failed attempts.
+	RetryAfter time.Duration
+	// Dialer is used by probes created from connection strings and host/port pairs.
+	// If nil, direct connection is used.
+	Dialer Dialer
+	// Classify tells retryable errors from permanent ones, wait fails immediately on
+	// permanent errors. If nil, ClassifyError is used.
+	Classify Classifier
+	// Registry records state and metrics of waited endpoints. If nil, DefaultRegistry
+	// is used.
+	Registry *Registry
+	// Limiter if not nil is waited before every probe's attempt. Share one limiter
+	// between waiters to cap attempts across all waited services.
+	Limiter Limiter
+}
+
+// Limiter limits rate of probe's attempts, see package ratelimit.
+type Limiter interface {
+	// Wait blocks until attempt can be made or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// WaitProbe calls probe until it succeeds, timeout elapses or ctx is done. Returns last
+// probe's error in case of failure.
+func (w *Waiter) WaitProbe(ctx context.Context, p Probe) error {
+	ctx, cancel := w.context(ctx)
+	defer cancel()
+
+	return w.waitProbe(ctx, probeName(p), p)
+}
+
+// WaitTCPPort waits while it can connect to specified tcp port.
+func (w *Waiter) WaitTCPPort(ctx context.Context, host, port string) error {
+	ctx, cancel := w.context(ctx)
+	defer cancel()
+
+	return w.waitHostPort(ctx, "", host, port, &TCPProbe{Addr: host + ":" + port, Dialer: w.Dialer})
+}
+
+// WaitSQL waits while db can be pinged and all checks succeed. Returns *SQLError in case
+// of failure. Wait stops immediately if database rejects connection.
+func (w *Waiter) WaitSQL(ctx context.Context, db *sql.DB, checks ...SQLCheck) error {
+	return w.WaitProbe(ctx, &SQLProbe{DB: db, Checks: checks})
+}
+
+// WaitServices waits for all specified services to be available. See package's WaitServices
+// for supported connection strings.
+func (w *Waiter) WaitServices(ctx context.Context, services ...string) error {
+	ctx, cancel := w.context(ctx)
+	defer cancel()
+
+	for _, s := range services {
+		err := w.waitService(ctx, s, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitService waits for service specified by connection string s. Attempts are recorded in
+// registry under name, if empty name is derived from s.
+func (w *Waiter) waitService(ctx context.Context, s, name string) error {
+	if regexSRVScheme.MatchString(s) {
+		p, err := parseSRVService(s)
+		if err != nil {
+			return err
+		}
+		p.Dialer = w.Dialer
+		if name == "" {
+			name = p.Name
+		}
+
+		err = w.waitProbe(ctx, name, p)
+		if err != nil {
+			return errors.Wrapf(err, "Service %s not available: ", p.Name)
+		}
+		return nil
+	}
+
+	h, p := parseConnectionString(s)
+	if h == "" || p == "" {
+		return errors.New("Can not parse service connection string: " + Redact(s))
+	}
+
+	if regexGRPCScheme.MatchString(s) {
+		gp, err := grpcServiceProbe(s, h, p)
+		if err != nil {
+			return err
+		}
+		gp.Dialer = w.Dialer
+		return w.waitHostPort(ctx, name, h, p, gp)
+	}
+
+	if lp := lineServiceProbe(s, h, p); lp != nil {
+		lp.Dialer = w.Dialer
+		return w.waitHostPort(ctx, name, h, p, lp)
+	}
+
+	return w.waitHostPort(ctx, name, h, p, w.serviceProbe(s, h, p))
+}
+
+func (w *Waiter) serviceProbe(s, host, port string) Probe {
+	if p := tlsServiceProbe(s, host, port); p != nil {
+		p.Dialer = w.Dialer
+		return p
+	}
+	return &TCPProbe{Addr: host + ":" + port, Dialer: w.Dialer}
+}
+
+func (w *Waiter) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if w.Timeout > 0 {
+		return context.WithTimeout(ctx, w.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// waitHostPort waits for probe of service at host:port, attempts are recorded in registry
+// under name or under host:port if name is empty.
+func (w *Waiter) waitHostPort(ctx context.Context, name, host, port string, p Probe) error {
+	if name == "" {
+		name = host + ":" + port
+	}
+
+	err := w.waitProbe(ctx, name, p)
+	if err == nil {
+		return nil
+	}
+
+	var dnsErr *net.DNSError
+	notResolved := std_errors.As(err, &dnsErr)
+	permanent := w.classify(err) == Permanent
+	switch {
+	case notResolved && permanent:
+		return errors.Wrapf(err, "Service %s:%s not resolved, not retrying: ", host, port)
+	case notResolved:
+		return errors.Wrapf(err, "Service %s:%s not resolved: ", host, port)
+	case permanent:
+		return errors.Wrapf(err, "Service %s:%s not available, not retrying: ", host, port)
+	}
+	return errors.Wrapf(err, "Servcie %s:%s not available", host, port)
+}
+
+// waitProbe waits for probe, attempts are recorded in registry under name.
+func (w *Waiter) waitProbe(ctx context.Context, name string, p Probe) error {
+	r := w.registry()
+	start := time.Now()
+	attempts := 0
+	limited := false
+
+	policy := retry.Policy{
+		Delay:     w.RetryAfter,
+		Retryable: func(err error) bool { return !limited && w.classify(err) != Permanent },
+		MaxErrors: 1, // only last error is reported
+	}
+	if pw, ok := p.(Watcher); ok {
+		wctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		policy.Wake = pw.Watch(wctx)
+	}
+
+	var lastErr error
+	err := retry.Run(ctx, policy, func(ctx context.Context) error {
+		if w.Limiter != nil {
+			err := w.Limiter.Wait(ctx)
+			if err != nil {
+				// no attempt is made, report previous attempt's error if any
+				limited = true
+				if lastErr != nil {
+					return lastErr
+				}
+				return errors.Wrap(err, "Probe's attempt not allowed by limiter: ")
+			}
+		}
+
+		attemptStart := time.Now()
+		err := w.attempt(ctx, p)
+		r.Record(name, err, time.Since(attemptStart))
+		attempts++
+		if err != nil && ctx.Err() != nil && lastErr != nil {
+			// attempt was cut short by wait's deadline, previous error tells more
+			return lastErr
+		}
+		lastErr = err
+		return err
+	})
+	err = retry.Last(err)
+	r.recordWait(name, attempts, time.Since(start), err)
+	return err
+}
+
+func (w *Waiter) attempt(ctx context.Context, p Probe) error {
+	if w.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.AttemptTimeout)
+		defer cancel()
+	}
+	return p.Probe(ctx)
+}
+
+func (w *Waiter) registry() *Registry {
+	if w.Registry != nil {
+		return w.Registry
+	}
+	return DefaultRegistry
+}
+
+func (w *Waiter) classify(err error) ErrorClass {
+	if w.Classify != nil {
+		return w.Classify(err)
+	}
+	return ClassifyError(err)
+}
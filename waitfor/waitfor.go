@@ -3,11 +3,9 @@ package waitfor
 import (
 	"context"
 	"database/sql"
-	"net"
 	"regexp"
+	"strings"
 	"time"
-
-	"github.com/hummerd/gostuff/errors"
 )
 
 var (
@@ -28,45 +26,58 @@ var (
 	}
 )
 
-func WaitSQL(timeout, retryAfter time.Duration, db *sql.DB) error {
-	start := time.Now()
-	left := timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// WaitSQL waits while db can be pinged and all checks succeed. Returns *SQLError in case
+// of failure. Wait stops immediately if database rejects connection (see SQLError).
+func WaitSQL(timeout, retryAfter time.Duration, db *sql.DB, checks ...SQLCheck) error {
+	w := &Waiter{Timeout: timeout, RetryAfter: retryAfter}
+	return w.WaitSQL(context.Background(), db, checks...)
+}
 
-	for {
-		err := db.PingContext(ctx)
-		if err == nil {
-			return nil
-		}
+// WaitSQLNamed is WaitSQL that reports db in registry under name (e.g. Redact(dsn)), see
+// SQLProbe.Name.
+func WaitSQLNamed(timeout, retryAfter time.Duration, name string, db *sql.DB, checks ...SQLCheck) error {
+	w := &Waiter{Timeout: timeout, RetryAfter: retryAfter}
+	return w.WaitProbe(context.Background(), &SQLProbe{DB: db, Checks: checks, Name: name})
+}
 
-		time.Sleep(retryAfter)
+// WaitSQLAttempts is WaitSQLNamed with every attempt (ping and checks) limited by
+// attemptTimeout, so single hanging ping can not use whole timeout.
+func WaitSQLAttempts(timeout, attemptTimeout, retryAfter time.Duration, name string, db *sql.DB, checks ...SQLCheck) error {
+	w := &Waiter{Timeout: timeout, AttemptTimeout: attemptTimeout, RetryAfter: retryAfter}
+	return w.WaitProbe(context.Background(), &SQLProbe{DB: db, Checks: checks, Name: name})
+}
 
-		left = timeout - time.Since(start)
-		if left < 0 {
-			return errors.Wrap(err, "DB is not available: ")
-		}
-	}
+// Probe checks once whether service is ready.
+type Probe interface {
+	Probe(ctx context.Context) error
 }
 
-// WaitTCPPort wait while it can connect to specified tcp port
-func WaitTCPPort(timeout, retryAfter time.Duration, host, port string) error {
-	start := time.Now()
-	left := timeout
-	for {
-		conn, err := net.DialTimeout("tcp", host+":"+port, left)
-		if conn != nil {
-			_ = conn.Close()
-			return nil
-		}
+// ProbeFunc is an adapter to allow the use of ordinary functions as probes.
+type ProbeFunc func(ctx context.Context) error
 
-		time.Sleep(retryAfter)
+// Probe calls f(ctx).
+func (f ProbeFunc) Probe(ctx context.Context) error {
+	return f(ctx)
+}
 
-		left = timeout - time.Since(start)
-		if left < 0 {
-			return errors.Wrapf(err, "Servcie %s:%s not available", host, port)
-		}
-	}
+// Watcher can be implemented by probe to notify about changes of checked resource, so that
+// next attempt is made right after change instead of after retry pause. Watch returns nil
+// channel if changes can not be watched. Watching stops when ctx is done.
+type Watcher interface {
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// WaitProbe calls probe until it succeeds or timeout elapses. Returns last probe's error
+// in case of timeout.
+func WaitProbe(timeout, retryAfter time.Duration, p Probe) error {
+	w := &Waiter{Timeout: timeout, RetryAfter: retryAfter}
+	return w.WaitProbe(context.Background(), p)
+}
+
+// WaitTCPPort wait while it can connect to specified tcp port
+func WaitTCPPort(timeout, retryAfter time.Duration, host, port string) error {
+	w := &Waiter{Timeout: timeout, RetryAfter: retryAfter}
+	return w.WaitTCPPort(context.Background(), host, port)
 }
 
 // WaitServices waits for all specified services to be available.
@@ -77,23 +88,38 @@ func WaitTCPPort(timeout, retryAfter time.Duration, host, port string) error {
 //   user:password@network(host:port)/path?etc
 //   host=host port=port
 //   port=port host=host
+//   srv+tcp://_service._proto.name?mode=any|all|quorum&quorum=n
+//
+// Services with https://, rediss:// or amqps:// scheme and services with sslmode=require
+// or sslmode=verify-full are checked with TLS handshake (see TLSProbe). Services with
+// grpc://host:port/service or grpcs://host:port/service (TLS) connection string are checked
+// with gRPC health checking protocol (see GRPCHealthProbe). Services with memcached://,
+// nats:// or smtp:// scheme are checked with protocol's greeting and command (see LineProbe).
+// Other services are checked with tcp connection.
 func WaitServices(timeout, retryAfter time.Duration, services ...string) error {
-	start := time.Now()
-	left := timeout
-	for _, s := range services {
-		h, p := parseConnectionString(s)
-		if h == "" || p == "" {
-			return errors.New("Can not parse service connection string: " + s)
-		}
+	w := &Waiter{Timeout: timeout, RetryAfter: retryAfter}
+	return w.WaitServices(context.Background(), services...)
+}
 
-		err := WaitTCPPort(left, retryAfter, h, p)
-		if err != nil {
-			return err
-		}
-		left = timeout - time.Since(start)
-	}
+// TCPProbe checks that tcp connection to Addr can be established.
+type TCPProbe struct {
+	// Addr is service address in host:port form.
+	Addr string
+	// Dialer is used to connect to service. If nil, direct connection is used.
+	Dialer Dialer
+}
 
-	return nil
+// Probe connects to service and closes connection.
+func (p *TCPProbe) Probe(ctx context.Context) error {
+	return dialTCP(ctx, p.Dialer, p.Addr)
+}
+
+func dialTCP(ctx context.Context, d Dialer, addr string) error {
+	conn, err := dialer(d).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
 }
 
 func parseConnectionString(str string) (host, port string) {
@@ -109,6 +135,10 @@ func parseConnectionString(str string) (host, port string) {
 					}
 				}
 			}
+			// host never contains @, the rest is user info (user:password@host:port)
+			if at := strings.LastIndex(host, "@"); at >= 0 {
+				host = host[at+1:]
+			}
 			return
 		}
 	}
@@ -1,12 +1,17 @@
 package waitfor
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/hummerd/gostuff/errors"
+	"github.com/hummerd/gostuff/ratelimit"
 )
 
 func TestParseConnectionString(t *testing.T) {
@@ -120,6 +125,24 @@ func TestWaitFail(t *testing.T) {
 	}
 }
 
+func TestWaitKeepsLastRealError(t *testing.T) {
+	attempts := 0
+	p := ProbeFunc(func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("certificate expired")
+		}
+		// hangs until wait's deadline
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := WaitProbe(time.Millisecond*200, time.Millisecond*10, p)
+	if err == nil || !strings.Contains(err.Error(), "certificate expired") {
+		t.Fatal("Deadline error replaced probe's error", err)
+	}
+}
+
 func TestWaitServices(t *testing.T) {
 	lone, err := net.ListenTCP("tcp", &net.TCPAddr{net.IPv4(127, 0, 0, 1), 0, ""})
 	if err != nil {
@@ -143,3 +166,34 @@ func TestWaitServices(t *testing.T) {
 		t.Fatal("Services not available", err)
 	}
 }
+
+func TestWaiterLimiter(t *testing.T) {
+	// two waiters share limiter, so attempts of both are capped together
+	limiter := ratelimit.NewTokenBucket(20, 1)
+	var attempts int32
+	down := ProbeFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&attempts, 1)
+		return errors.New("down")
+	})
+
+	wg := sync.WaitGroup{}
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := &Waiter{Timeout: time.Millisecond * 250, Limiter: limiter, Registry: NewRegistry()}
+			errs[i] = w.WaitProbe(context.Background(), down)
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&attempts); n < 2 || n > 7 {
+		t.Fatal("Attempts not limited", n)
+	}
+	for _, err := range errs {
+		if err == nil || err.Error() != "down" {
+			t.Fatal("Expected probe's error", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package waitfortest
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// NewHTTPServer starts fake server that serves connections accepted in Accept mode with h.
+// Banner and Handler from cfg are ignored.
+func NewHTTPServer(h http.Handler, cfg Config) *Server {
+	cl := &connListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	hs := &http.Server{Handler: h}
+
+	cfg.Banner = nil
+	cfg.Handler = func(conn net.Conn) {
+		nc := &notifyConn{Conn: conn, closed: make(chan struct{})}
+		select {
+		case cl.conns <- nc:
+		case <-cl.done:
+			return
+		}
+
+		// http server owns connection now, wait while it is done with it
+		select {
+		case <-nc.closed:
+		case <-cl.done:
+		}
+	}
+
+	s := NewServer(cfg)
+	cl.addr = s.Addr
+	s.onClose = func() {
+		cl.Close()
+		_ = hs.Close()
+	}
+
+	go func() { _ = hs.Serve(cl) }()
+	return s
+}
+
+// connListener passes connections accepted by Server to http.Server.
+type connListener struct {
+	addr  string
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	a, _ := net.ResolveTCPAddr("tcp", l.addr)
+	return a
+}
+
+type notifyConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *notifyConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,357 @@
+// Package waitfortest provides fake servers for testing service startup logic against
+// real failure modes: late start, dropped and half-open connections, delayed banners and
+// flapping.
+package waitfortest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server modes.
+const (
+	// Down closes listener, connections are refused. Active connections are closed too.
+	Down Mode = iota
+	// Accept accepts connections, sends Banner and serves them with Handler.
+	Accept
+	// Drop accepts connections and closes them right away.
+	Drop
+	// HalfOpen accepts connections but never reads from or writes to them.
+	HalfOpen
+)
+
+// Mode is server's behavior.
+type Mode int
+
+// String returns mode name.
+func (m Mode) String() string {
+	switch m {
+	case Down:
+		return "down"
+	case Accept:
+		return "accept"
+	case Drop:
+		return "drop"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Step is part of server's schedule: server is in Mode for Duration. Last step
+// lasts until server is closed or mode is changed with SetMode.
+type Step struct {
+	Mode     Mode
+	Duration time.Duration
+}
+
+// Config describes fake server.
+type Config struct {
+	// Banner is sent to every connection accepted in Accept mode.
+	Banner []byte
+	// BannerDelay is pause before Banner is sent.
+	BannerDelay time.Duration
+	// Handler serves connections accepted in Accept mode after banner is sent. Connection is
+	// closed when Handler returns. If nil, connection is held open until client closes it.
+	Handler func(conn net.Conn)
+	// Schedule is list of modes server goes through. Empty schedule means Accept forever.
+	Schedule []Step
+}
+
+// Server is fake tcp server. Server's address does not change when it goes down and up.
+type Server struct {
+	// Addr is server's address in host:port form.
+	Addr string
+
+	cfg      Config
+	mu       sync.Mutex
+	mode     Mode
+	l        net.Listener
+	conns    map[net.Conn]chan struct{}
+	accepted int
+	stop     chan struct{}
+	closed   chan struct{}
+	wg       sync.WaitGroup
+	onClose  func()
+}
+
+// NewServer starts new fake server on loopback interface. It panics if it can not listen,
+// like httptest.NewServer.
+func NewServer(cfg Config) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("waitfortest: can not listen: " + err.Error())
+	}
+	return newServer(l, cfg)
+}
+
+func newServer(l net.Listener, cfg Config) *Server {
+	s := &Server{
+		Addr:   l.Addr().String(),
+		cfg:    cfg,
+		mode:   Accept,
+		conns:  map[net.Conn]chan struct{}{},
+		stop:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+
+	schedule := cfg.Schedule
+	if len(schedule) == 0 {
+		schedule = []Step{{Mode: Accept}}
+	}
+
+	s.mu.Lock()
+	s.l = l
+	s.wg.Add(1)
+	go s.acceptLoop(l)
+	_ = s.setMode(schedule[0].Mode)
+	s.mu.Unlock()
+
+	if len(schedule) > 1 || schedule[0].Duration > 0 {
+		s.wg.Add(1)
+		go s.runSchedule(schedule)
+	}
+	return s
+}
+
+// Host returns server's host.
+func (s *Server) Host() string {
+	h, _, _ := net.SplitHostPort(s.Addr)
+	return h
+}
+
+// Port returns server's port.
+func (s *Server) Port() string {
+	_, p, _ := net.SplitHostPort(s.Addr)
+	return p
+}
+
+// Mode returns current server's mode.
+func (s *Server) Mode() Mode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode
+}
+
+// SetMode changes server's mode and stops schedule.
+func (s *Server) SetMode(m Mode) error {
+	s.stopSchedule()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setMode(m)
+}
+
+// Accepted returns number of accepted connections.
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// Close stops server and closes all connections.
+func (s *Server) Close() {
+	s.stopSchedule()
+
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	_ = s.setMode(Down)
+	close(s.closed)
+	s.mu.Unlock()
+
+	if s.onClose != nil {
+		s.onClose()
+	}
+	s.wg.Wait()
+}
+
+func (s *Server) stopSchedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+func (s *Server) runSchedule(schedule []Step) {
+	defer s.wg.Done()
+
+	for i, st := range schedule {
+		if i > 0 {
+			s.mu.Lock()
+			select {
+			case <-s.stop:
+				s.mu.Unlock()
+				return
+			default:
+			}
+			_ = s.setMode(st.Mode)
+			s.mu.Unlock()
+		}
+
+		if i == len(schedule)-1 {
+			return
+		}
+
+		t := time.NewTimer(st.Duration)
+		select {
+		case <-s.stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// setMode must be called with s.mu locked.
+func (s *Server) setMode(m Mode) error {
+	select {
+	case <-s.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	s.mode = m
+	if m == Down {
+		if s.l != nil {
+			_ = s.l.Close()
+			s.l = nil
+		}
+		for c, done := range s.conns {
+			_ = c.Close()
+			close(done)
+			delete(s.conns, c)
+		}
+		return nil
+	}
+
+	if s.l == nil {
+		l, err := net.Listen("tcp", s.Addr)
+		if err != nil {
+			return err
+		}
+		s.l = l
+		s.wg.Add(1)
+		go s.acceptLoop(l)
+	}
+	return nil
+}
+
+func (s *Server) acceptLoop(l net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.accepted++
+		mode := s.mode
+		if mode == Drop || mode == Down {
+			s.mu.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		done := make(chan struct{})
+		s.conns[conn] = done
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(conn, mode, done)
+	}
+}
+
+// serve serves accepted connection, done is closed when server goes down.
+func (s *Server) serve(conn net.Conn, mode Mode, done chan struct{}) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		if _, ok := s.conns[conn]; ok {
+			delete(s.conns, conn)
+			close(done)
+		}
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	if mode == HalfOpen {
+		<-done
+		return
+	}
+
+	if s.cfg.BannerDelay > 0 {
+		t := time.NewTimer(s.cfg.BannerDelay)
+		select {
+		case <-done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+
+	if len(s.cfg.Banner) > 0 {
+		_, err := conn.Write(s.cfg.Banner)
+		if err != nil {
+			return
+		}
+	}
+
+	if s.cfg.Handler != nil {
+		s.cfg.Handler(conn)
+		return
+	}
+
+	// wait while client closes connection, discarding its data
+	buf := make([]byte, 512)
+	for {
+		_, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ReplyHandler returns Handler for line based protocols. For every received line (without
+// trailing \r\n) reply for the longest matching command prefix is written. Unknown lines are
+// ignored.
+func ReplyHandler(replies map[string]string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+
+			cmd := ""
+			for c := range replies {
+				if strings.HasPrefix(line, c) && len(c) >= len(cmd) {
+					cmd = c
+				}
+			}
+
+			reply, ok := replies[cmd]
+			if !ok {
+				continue
+			}
+			_, err = conn.Write([]byte(reply))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
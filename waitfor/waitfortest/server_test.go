@@ -0,0 +1,161 @@
+package waitfortest_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hummerd/gostuff/waitfor"
+	"github.com/hummerd/gostuff/waitfor/waitfortest"
+)
+
+func TestServerStartLate(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Schedule: []waitfortest.Step{
+			{Mode: waitfortest.Down, Duration: time.Millisecond * 200},
+			{Mode: waitfortest.Accept},
+		},
+	})
+	defer s.Close()
+
+	_, err := net.Dial("tcp", s.Addr)
+	if err == nil {
+		t.Fatal("Down server accepted connection")
+	}
+
+	err = waitfor.WaitTCPPort(time.Second, time.Millisecond*50, s.Host(), s.Port())
+	if err != nil {
+		t.Fatal("Server not available", err)
+	}
+	if s.Mode() != waitfortest.Accept {
+		t.Fatal("Wrong mode", s.Mode())
+	}
+}
+
+func TestServerModes(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Banner:      []byte("220 ready\r\n"),
+		BannerDelay: time.Millisecond * 100,
+		Handler:     waitfortest.ReplyHandler(map[string]string{"PING": "PONG\r\n"}),
+	})
+	defer s.Close()
+
+	// banner delay starts at accept, so clock starts before dial
+	start := time.Now()
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil || line != "220 ready\r\n" || time.Since(start) < time.Millisecond*100 {
+		t.Fatal("Wrong banner", line, err, time.Since(start))
+	}
+
+	_, _ = conn.Write([]byte("PING\r\n"))
+	line, err = r.ReadString('\n')
+	if err != nil || line != "PONG\r\n" {
+		t.Fatal("Wrong reply", line, err)
+	}
+
+	// going down closes active connections
+	err = s.SetMode(waitfortest.Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = r.ReadString('\n')
+	if err != io.EOF {
+		t.Fatal("Connection not closed", err)
+	}
+	conn.Close()
+
+	err = s.SetMode(waitfortest.Drop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dropping server does not accept connections", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil {
+		t.Fatal("Connection not dropped")
+	}
+	conn.Close()
+
+	err = s.SetMode(waitfortest.HalfOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Half-open server does not accept connections", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+	_, err = conn.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatal("Half-open connection answered", err)
+	}
+
+	if s.Accepted() != 3 {
+		t.Fatal("Wrong accepted count", s.Accepted())
+	}
+}
+
+func TestServerFlap(t *testing.T) {
+	s := waitfortest.NewServer(waitfortest.Config{
+		Schedule: []waitfortest.Step{
+			{Mode: waitfortest.Accept, Duration: time.Millisecond * 200},
+			{Mode: waitfortest.Down, Duration: time.Millisecond * 200},
+			{Mode: waitfortest.Accept},
+		},
+	})
+	defer s.Close()
+
+	modes := []waitfortest.Mode{}
+	for i := 0; i < 6; i++ {
+		if len(modes) == 0 || modes[len(modes)-1] != s.Mode() {
+			modes = append(modes, s.Mode())
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if len(modes) != 3 || modes[1] != waitfortest.Down || modes[2] != waitfortest.Accept {
+		t.Fatal("Wrong schedule", modes)
+	}
+}
+
+func TestHTTPServer(t *testing.T) {
+	s := waitfortest.NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), waitfortest.Config{
+		Schedule: []waitfortest.Step{
+			{Mode: waitfortest.HalfOpen, Duration: time.Millisecond * 200},
+			{Mode: waitfortest.Accept},
+		},
+	})
+	defer s.Close()
+
+	c := &http.Client{Timeout: time.Millisecond * 100}
+	_, err := c.Get("http://" + s.Addr)
+	if err == nil {
+		t.Fatal("Half-open server answered")
+	}
+
+	time.Sleep(time.Millisecond * 200)
+	resp, err := c.Get("http://" + s.Addr)
+	if err != nil {
+		t.Fatal("Server not available", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal("Wrong status", resp.StatusCode)
+	}
+}